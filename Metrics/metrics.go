@@ -0,0 +1,114 @@
+// Package Metrics holds the Prometheus collectors describing what the server is up to.
+package Metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "blocklistsrv"
+
+var (
+	CallbacksReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "callbacks_received_total",
+		Help:      "Callbacks accepted from clients.",
+	})
+	CallbacksProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "callbacks_processed_total",
+		Help:      "Callbacks matched against the index, by whether the world is supervised or unknown.",
+	}, []string{"world"})
+	Misses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "misses_total",
+		Help:      "Blocklist entries reported as unmatched, by blocklist title.",
+	}, []string{"blocklist"})
+	MissesSuppressed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "misses_suppressed_total",
+		Help:      "Misses held back because their reporter already reported them recently.",
+	})
+	MissesAwaitingQuorum = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "misses_awaiting_quorum_total",
+		Help:      "Misses held back because too few distinct reporters reported them yet.",
+	})
+	IngestRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ingest_rejected_total",
+		Help:      "Callbacks turned away because the ingest queue was full.",
+	})
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Callbacks turned away by rate limiting, by whether the client or world limit was hit.",
+	}, []string{"limit"})
+
+	ReceiverWriteDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "receiver_write_duration_seconds",
+		Help:      "Time receivers took to write a report, or a batch for receivers writing in batches.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"receiver"})
+	ReceiverWriteErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "receiver_write_errors_total",
+		Help:      "Reports or batches receivers failed to deliver.",
+	}, []string{"receiver"})
+	ReceiverDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "receiver_dropped_total",
+		Help:      "Reports dropped because the receiver's queue was full.",
+	}, []string{"receiver"})
+
+	IndexBuildDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "index_build_duration_seconds",
+		Help:      "Time it took to fetch all sources and build an index generation.",
+		Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	})
+	IndexLastBuild = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "index_last_build_timestamp_seconds",
+		Help:      "When the current index generation was built.",
+	})
+	IndexGeneration = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "index_generation",
+		Help:      "Generation number of the current index.",
+	})
+	IndexWorlds = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "index_worlds",
+		Help:      "Worlds in the current index.",
+	})
+	IndexObjects = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "index_objects",
+		Help:      "Objects across all worlds in the current index.",
+	})
+
+	SourceFetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "source_fetch_duration_seconds",
+		Help:      "Time it took to fetch and parse a blocklist source.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"source"})
+	SourceFetchFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "source_fetch_failures_total",
+		Help:      "Failed attempts to fetch or parse a blocklist source.",
+	}, []string{"source"})
+	SourceVerificationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "source_verification_failures_total",
+		Help:      "Blocklists that didn't match their pinned digest or signature, also counted as fetch failures.",
+	}, []string{"source"})
+
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook deliveries received, by GitHub event type, \"other\" for events that aren't handled.",
+	}, []string{"event"})
+)
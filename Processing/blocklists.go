@@ -1,36 +1,52 @@
 package Processing
 
 import (
+	"AGB-BlocklistSrv/Metrics"
+	"cmp"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"github.com/pelletier/go-toml/v2"
-	"io"
-	"net/http"
+	"fmt"
+	"github.com/gofiber/fiber/v2/log"
+	"math"
 	"net/url"
 	"os"
+	"sync"
+	"time"
 )
 
 type WorldObject struct {
 	FriendlyName      string
 	GameObjectMapping map[string]Gameobject
 }
-type WorldObjectIndex struct {
-	Index map[string]WorldObject
-}
 
+// Blocklist is a blocklist as maintainers write it. Every format uses the same keys, objects are hashed the same no
+// matter which format they were read from.
 type Blocklist struct {
-	Title       string  `toml:"title"`
-	Description string  `toml:"-"`
-	Maintainer  string  `toml:"-"`
-	Blocks      []Block `toml:"block"`
+	Title       string  `toml:"title" json:"title" yaml:"title"`
+	Description string  `toml:"description" json:"description" yaml:"description"`
+	Maintainer  string  `toml:"maintainer" json:"maintainer" yaml:"maintainer"`
+	Blocks      []Block `toml:"block" json:"block" yaml:"block"`
+}
+
+// BlocklistInfo describes a blocklist as it was indexed in one generation, so misses can be traced back to who
+// maintains the list and which revision of it they were missed against.
+type BlocklistInfo struct {
+	Title       string
+	Description string
+	Maintainer  string
+	// Source is the location the blocklist was fetched from.
+	Source string
+	// Revision identifies the content that was indexed, see SourceResult.Revision.
+	Revision string
 }
 
 type Block struct {
-	FriendlyName string       `toml:"friendly_name" json:"friendly_name"`
-	WorldId      string       `toml:"world_id" json:"world_id"`
-	GameObjects  []Gameobject `toml:"game_objects" json:"game_objects"`
+	FriendlyName string       `toml:"friendly_name" json:"friendly_name" yaml:"friendly_name"`
+	WorldId      string       `toml:"world_id" json:"world_id" yaml:"world_id"`
+	GameObjects  []Gameobject `toml:"game_objects" json:"game_objects" yaml:"game_objects"`
 }
 
 type CallbackContainer struct {
@@ -39,22 +55,20 @@ type CallbackContainer struct {
 	UnmatchedObjects []string `json:"UnmatchedObjects"`
 }
 
+// Gameobject is hashed as JSON, so its json tags must not change. Decoding JSON matches keys regardless of case, so
+// JSON blocklists can use the same keys as the other formats anyway.
 type Gameobject struct {
-	Name            string              `toml:"name" json:"Name"`
-	Position        *GameobjectPosition `toml:"position" json:"Position"`
-	Parent          *Gameobject         `toml:"parent" json:"Parent"`
-	ParentBlocklist *string             `json:"-,omitempty"`
+	Name            string              `toml:"name" json:"Name" yaml:"name"`
+	Position        *GameobjectPosition `toml:"position" json:"Position" yaml:"position"`
+	Parent          *Gameobject         `toml:"parent" json:"Parent" yaml:"parent"`
+	ParentBlocklist *BlocklistInfo      `toml:"-" json:"-" yaml:"-"`
 }
 type GameobjectPosition struct {
-	X float64 `toml:"x" json:"X"`
-	Y float64 `toml:"y" json:"Y"`
-	Z float64 `toml:"z" json:"Z"`
+	X float64 `toml:"x" json:"X" yaml:"x"`
+	Y float64 `toml:"y" json:"Y" yaml:"y"`
+	Z float64 `toml:"z" json:"Z" yaml:"z"`
 }
 
-var (
-	Index = WorldObjectIndex{}
-)
-
 func (index WorldObjectIndex) GetWorldById(HashedWorldId string) *WorldObject {
 	if val, exists := index.Index[HashedWorldId]; exists {
 		return &val
@@ -62,52 +76,250 @@ func (index WorldObjectIndex) GetWorldById(HashedWorldId string) *WorldObject {
 	return nil
 }
 
-func (index WorldObjectIndex) HandleBlocklistCallback(object CallbackContainer) {
+func (index WorldObjectIndex) HandleBlocklistCallback(object IncomingCallback) {
 	var world *WorldObject
 	if world = index.GetWorldById(object.WorldId); world == nil { // Return immediately if not under our supervision
+		Metrics.CallbacksProcessed.WithLabelValues("unknown").Inc()
 		return
 	}
+	Metrics.CallbacksProcessed.WithLabelValues("supervised").Inc()
 
-	var misses []Gameobject
+	var misses []Miss
 	for _, b64 := range object.UnmatchedObjects {
 		if val, exists := world.GameObjectMapping[b64]; exists {
-			misses = append(misses, val)
+			misses = append(misses, Miss{Gameobject: val, Hash: b64})
+			Metrics.Misses.WithLabelValues(val.ParentBlocklist.Title).Inc()
+		}
+	}
+	for _, filter := range MissFilters() {
+		if len(misses) == 0 {
+			break
 		}
+		misses = filter.Filter(object, misses)
 	}
 
-	if len(misses) == 0 { // None of the objects reported back are relevant to us
+	if len(misses) == 0 { // None of the objects reported back are relevant to us, or they were held back
 		return
 	}
 
-	ChosenReceiver.SendToRemote(misses, world)
+	Receivers().Deliver(MissReport{World: world, WorldId: object.WorldId, Misses: misses, ReceivedAt: object.ReceivedAt})
+}
+
+// SourceResult records how a single blocklist source fared while an index was generated.
+type SourceResult struct {
+	Location string
+	// Error is set if fetching or parsing the source failed, even if a cached copy could stand in.
+	Error     string `json:",omitempty"`
+	FromCache bool
+	// NotModified is set if the server confirmed our previous copy is still current, so it wasn't parsed again.
+	NotModified bool
+	// Reused is set if the source wasn't fetched at all because only other sources were refreshed.
+	Reused bool `json:",omitempty"`
+	// Bytes is how much was downloaded, 0 unless the source was fetched and parsed.
+	Bytes   int
+	Worlds  int
+	Objects int
+	// Revision identifies the content that was indexed as "sha256:" and its hex encoded SHA-256, or as the commit it
+	// was read at for git sources. It is empty if the source was left out of the index.
+	Revision string `json:",omitempty"`
 }
 
-func GenerateObjectIndex(blocklistsLocations []string) (mapping map[string]WorldObject) {
+// GenerateObjectIndex builds the mapping from all blocklists it can get hold of. A source that fails is replaced
+// by its cached copy if there is one, otherwise it is left out. Either way, the failure ends up in results.
+// blocklists describes every blocklist that made it into the mapping.
+func GenerateObjectIndex(blocklistsLocations []string) (mapping map[string]WorldObject, results []SourceResult, blocklists []*BlocklistInfo) {
+	return generateObjectIndex(blocklistsLocations, func(string) bool { return true })
+}
+
+// generateObjectIndex builds the mapping like GenerateObjectIndex, but only fetches sources refetch is true for.
+// The others are indexed from the copy they parsed to last time, if there is none they are left out.
+func generateObjectIndex(blocklistsLocations []string, refetch func(location string) bool) (mapping map[string]WorldObject, results []SourceResult, blocklists []*BlocklistInfo) {
 	mapping = make(map[string]WorldObject)
 	for _, blocklistUrl := range blocklistsLocations {
-		blocklistObject, err := fetchBlocklist(blocklistUrl)
-		if err != nil {
-			panic(err)
+		load := loadSource
+		if !refetch(blocklistUrl) {
+			load = reuseSource
 		}
+		blocklistObject, result, ok := load(blocklistUrl)
+		results = append(results, result)
+		if !ok {
+			continue
+		}
+		blocklists = append(blocklists, indexBlocklist(mapping, blocklistObject, result))
+	}
+	return mapping, results, blocklists
+}
 
-		for _, object := range blocklistObject.Blocks {
-			widHashEncoded := base64.StdEncoding.EncodeToString(stringToHash(object.WorldId))
+// indexBlocklist adds every object of blocklistObject to mapping, result is how its source fared.
+func indexBlocklist(mapping map[string]WorldObject, blocklistObject Blocklist, result SourceResult) *BlocklistInfo {
+	info := &BlocklistInfo{
+		Title:       blocklistObject.Title,
+		Description: blocklistObject.Description,
+		Maintainer:  blocklistObject.Maintainer,
+		Source:      result.Location,
+		Revision:    result.Revision,
+	}
+	for _, object := range blocklistObject.Blocks {
+		widHashEncoded := HashWorldId(object.WorldId)
 
-			ensureMappingInititalization(mapping, widHashEncoded, object)
+		ensureMappingInititalization(mapping, widHashEncoded, object)
 
-			for _, gameObject := range object.GameObjects {
-				marshal, err := json.Marshal(gameObject)
-				if err != nil {
-					panic(err)
-				}
+		for _, gameObject := range object.GameObjects {
+			b64 := HashGameobject(gameObject)
+			gameObject.ParentBlocklist = info
+			mapping[widHashEncoded].GameObjectMapping[b64] = gameObject
+		}
+	}
+	return info
+}
 
-				b64 := base64.StdEncoding.EncodeToString(stringToHash(marshal))
-				gameObject.ParentBlocklist = &blocklistObject.Title
-				mapping[widHashEncoded].GameObjectMapping[b64] = gameObject
-			}
+// HashWorldId returns the hash clients send for the world worldId.
+func HashWorldId(worldId string) string {
+	return base64.StdEncoding.EncodeToString(stringToHash(worldId))
+}
+
+// HashGameobject returns the hash clients send for object.
+func HashGameobject(object Gameobject) string {
+	marshal, err := json.Marshal(object)
+	if err != nil {
+		panic(err) // Only non-finite positions fail to encode, parseBlocklist refuses those
+	}
+	return base64.StdEncoding.EncodeToString(stringToHash(marshal))
+}
+
+// parsedSource is what a source parsed to the last time it was fetched successfully, or what its cached copy parsed
+// to if fetching it failed since.
+type parsedSource struct {
+	blocklist  Blocklist
+	validators httpValidators
+	revision   string
+	fromCache  bool
+	// options is what the source was verified and parsed with.
+	options SourceOptions
+}
+
+var (
+	parsedSources      = map[string]parsedSource{}
+	parsedSourcesMutex sync.Mutex
+)
+
+// loadSource fetches location, falling back to the cached copy if that fails. ok is false if neither worked.
+func loadSource(location string) (blocklistObject Blocklist, result SourceResult, ok bool) {
+	result.Location = location
+	defer func(attemptedAt time.Time) {
+		result.Worlds, result.Objects = len(blocklistObject.Blocks), countObjects(blocklistObject)
+		recordAttempt(result, attemptedAt)
+	}(time.Now())
+
+	// Validators are only remembered alongside a parsed copy, so a source that never parsed is fetched unconditionally
+	options := sourceOptionsFor(location)
+	parsedSourcesMutex.Lock()
+	previous := parsedSources[location]
+	parsedSourcesMutex.Unlock()
+	if !previous.options.equal(options) {
+		// An unchanged source can still verify or parse differently now, so it has to be fetched and looked at again
+		previous = parsedSource{}
+	}
+
+	fetchStarted := time.Now()
+	blocklistBytes, validators, err := fetchBlocklistBytes(location, previous.validators)
+	if errors.Is(err, errNotModified) {
+		Metrics.SourceFetchDuration.WithLabelValues(location).Observe(time.Since(fetchStarted).Seconds())
+		result.NotModified = true
+		result.Revision = previous.revision
+		return previous.blocklist, result, true
+	}
+	var signature []byte
+	if err == nil {
+		signature, err = verifySource(location, options, blocklistBytes, validators.Commit)
+	}
+	if err == nil {
+		blocklistObject, err = parseBlocklist(blocklistBytes, blocklistFormat(location, validators.ContentType))
+	}
+	Metrics.SourceFetchDuration.WithLabelValues(location).Observe(time.Since(fetchStarted).Seconds())
+	if err == nil {
+		cached := CachedSource{Bytes: blocklistBytes, ContentType: validators.ContentType, Signature: signature, Commit: validators.Commit}
+		if cacheErr := Cache.Store(location, cached); cacheErr != nil && !errors.Is(cacheErr, errCacheDisabled) {
+			log.Warnf("Failed to cache %s: %s", location, cacheErr.Error())
 		}
+		parsedSourcesMutex.Lock()
+		result.Revision = cmp.Or(validators.Commit, contentRevision(blocklistBytes))
+		parsedSources[location] = parsedSource{blocklist: blocklistObject, validators: validators, revision: result.Revision, options: options}
+		parsedSourcesMutex.Unlock()
+		result.Bytes = len(blocklistBytes)
+		return blocklistObject, result, true
+	}
+	result.Error = err.Error()
+	Metrics.SourceFetchFailures.WithLabelValues(location).Inc()
+	if errors.Is(err, errVerificationFailed) {
+		// Either the source or the configuration is wrong, neither fixes itself so it has to stand out
+		Metrics.SourceVerificationFailures.WithLabelValues(location).Inc()
+		log.Errorf("SECURITY: %s failed verification and won't be indexed until it passes: %s", location, err.Error())
 	}
-	return mapping
+
+	cached, cacheErr := Cache.Load(location)
+	if cacheErr != nil {
+		log.Errorf("Failed to fetch %s and no cached copy is available, leaving it out of the index: %s", location, err.Error())
+		forgetSource(location)
+		return Blocklist{}, result, false
+	}
+	// The copy passed what was configured when it was cached, which isn't necessarily what is configured now
+	cacheErr = verifyCopy(options, cached.Bytes, cached.Signature)
+	if cacheErr == nil {
+		blocklistObject, cacheErr = parseBlocklist(cached.Bytes, blocklistFormat(location, cached.ContentType))
+	}
+	if cacheErr != nil {
+		log.Errorf("Failed to fetch %s and the cached copy is unusable (%s), leaving it out of the index: %s", location, cacheErr.Error(), err.Error())
+		forgetSource(location)
+		return Blocklist{}, result, false
+	}
+
+	log.Warnf("Failed to fetch %s, indexing the last known good copy instead: %s", location, err.Error())
+	result.FromCache = true
+	result.Revision = cmp.Or(cached.Commit, contentRevision(cached.Bytes))
+	// Without validators, so the next attempt fetches it unconditionally
+	parsedSourcesMutex.Lock()
+	parsedSources[location] = parsedSource{blocklist: blocklistObject, revision: result.Revision, fromCache: true, options: options}
+	parsedSourcesMutex.Unlock()
+	return blocklistObject, result, true
+}
+
+// forgetSource drops what location parsed to, after it was left out of the index.
+func forgetSource(location string) {
+	parsedSourcesMutex.Lock()
+	defer parsedSourcesMutex.Unlock()
+	delete(parsedSources, location)
+}
+
+// reuseSource returns what location parsed to last time without fetching it. A source that has no usable copy is
+// left out, it is only fetched again when its own turn comes.
+func reuseSource(location string) (Blocklist, SourceResult, bool) {
+	parsedSourcesMutex.Lock()
+	previous, exists := parsedSources[location]
+	parsedSourcesMutex.Unlock()
+	if !exists {
+		return Blocklist{}, SourceResult{Location: location, Reused: true, Error: "no usable copy, left out until it is fetched again"}, false
+	}
+	return previous.blocklist, SourceResult{
+		Location:  location,
+		FromCache: previous.fromCache,
+		Reused:    true,
+		Worlds:    len(previous.blocklist.Blocks),
+		Objects:   countObjects(previous.blocklist),
+		Revision:  previous.revision,
+	}, true
+}
+
+// contentRevision identifies blocklistBytes for SourceResult.Revision.
+func contentRevision(blocklistBytes []byte) string {
+	return "sha256:" + hex.EncodeToString(stringToHash(blocklistBytes))
+}
+
+func countObjects(blocklistObject Blocklist) (objects int) {
+	for _, block := range blocklistObject.Blocks {
+		objects += len(block.GameObjects)
+	}
+	return objects
 }
 
 func ensureMappingInititalization(mapping map[string]WorldObject, widhashEncoded string, block Block) {
@@ -119,51 +331,81 @@ func ensureMappingInititalization(mapping map[string]WorldObject, widhashEncoded
 	}
 }
 
-func fetchBlocklist(location string) (Blocklist, error) {
-	uri, err := url.ParseRequestURI(location)
+// FetchBlocklist reads and parses the blocklist at location, bypassing the cache.
+func FetchBlocklist(location string) (Blocklist, error) {
+	blocklistBytes, validators, err := fetchBlocklistBytes(location, httpValidators{})
 	if err != nil {
 		return Blocklist{}, err
 	}
-	var blocklistBytes []byte
+	return parseBlocklist(blocklistBytes, blocklistFormat(location, validators.ContentType))
+}
+
+// fetchBlocklistBytes reads the blocklist at location. For HTTP sources, previous is sent as conditional request and
+// errNotModified is returned if the server says our copy is still current.
+func fetchBlocklistBytes(location string, previous httpValidators) ([]byte, httpValidators, error) {
+	uri, err := url.ParseRequestURI(location)
+	if err != nil {
+		return nil, httpValidators{}, err
+	}
 
 	switch uri.Scheme {
 	case "http", "https":
-		blocklistBytes, err = downloadBlocklistFromHTTP(location)
-		if err != nil {
-			return Blocklist{}, err
-		}
+		return downloadBlocklistFromHTTP(location, previous)
 	case "file":
 		_, err = os.Stat(uri.Path)
 		if err != nil {
-			return Blocklist{}, err
-		}
-		blocklistBytes, err = os.ReadFile(uri.Path)
-		if err != nil {
-			return Blocklist{}, err
+			return nil, httpValidators{}, err
 		}
+		blocklistBytes, err := os.ReadFile(uri.Path)
+		return blocklistBytes, httpValidators{}, err
+	case gitScheme:
+		return readGitBlocklist(uri, previous)
 	default:
-		return Blocklist{}, errors.New("unsupported scheme: " + uri.Scheme)
+		return nil, httpValidators{}, errors.New("unsupported scheme: " + uri.Scheme)
 	}
+}
 
-	var blocklistObject Blocklist
-	err = toml.Unmarshal(blocklistBytes, &blocklistObject)
+// parseBlocklist decodes blocklistBytes as format, refusing blocklists that can't be indexed.
+func parseBlocklist(blocklistBytes []byte, format string) (Blocklist, error) {
+	blocklistObject, err := decodeBlocklist(blocklistBytes, format)
 	if err != nil {
 		return Blocklist{}, err
 	}
+	if err = validateBlocklist(blocklistObject); err != nil {
+		return Blocklist{}, err
+	}
 	return blocklistObject, nil
 }
 
-func downloadBlocklistFromHTTP(location string) ([]byte, error) {
-	resp, err := http.Get(location)
-	if err != nil {
-		return nil, err
+// validateBlocklist refuses positions that aren't finite, objects are hashed as JSON which has no way to encode them.
+func validateBlocklist(blocklistObject Blocklist) error {
+	for _, block := range blocklistObject.Blocks {
+		for _, object := range block.GameObjects {
+			for current := &object; current != nil; current = current.Parent {
+				if !finitePosition(current.Position) {
+					return fmt.Errorf("object %q of %s has a position that isn't finite", object.Name, block.WorldId)
+				}
+			}
+		}
 	}
-	defer resp.Body.Close()
-	response, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	return nil
+}
+
+// finitePosition reports whether position has no NaN or infinite coordinates, a missing position is fine.
+func finitePosition(position *GameobjectPosition) bool {
+	if position == nil {
+		return true
+	}
+	for _, coordinate := range []float64{position.X, position.Y, position.Z} {
+		if math.IsNaN(coordinate) || math.IsInf(coordinate, 0) {
+			return false
+		}
 	}
-	return response, nil
+	return true
+}
+
+func downloadBlocklistFromHTTP(location string, previous httpValidators) ([]byte, httpValidators, error) {
+	return HTTPDownloader.Download(location, previous)
 }
 
 func stringToHash[inputs string | []byte](input inputs) (output []byte) {
@@ -2,6 +2,8 @@ package Processing
 
 import (
 	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -119,12 +121,12 @@ func Test_fetchBlocklist(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := fetchBlocklist(tt.args.location)
+			got, err := FetchBlocklist(tt.args.location)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("fetchBlocklist() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("FetchBlocklist() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			assert.EqualValuesf(t, tt.want, got, "fetchBlocklist() got = %v, want %v", got, tt.want)
+			assert.EqualValuesf(t, tt.want, got, "FetchBlocklist() got = %v, want %v", got, tt.want)
 		})
 	}
 }
@@ -213,7 +215,36 @@ func Test_generateObjectIndex(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			assert.Equalf(t, tt.wantMapping, GenerateObjectIndex(tt.args.blocklistsLocations), "generateObjectIndex(+%v)", tt.args.blocklistsLocations)
+			gotMapping, _, _ := GenerateObjectIndex(tt.args.blocklistsLocations)
+			assert.Equalf(t, tt.wantMapping, gotMapping, "generateObjectIndex(+%v)", tt.args.blocklistsLocations)
 		})
 	}
 }
+
+func Test_loadSourceFallsBackToCache(t *testing.T) {
+	Cache.SetDirectory(t.TempDir())
+	defer Cache.SetDirectory("")
+
+	blocklistPath := filepath.Join(t.TempDir(), "AGBTest.toml")
+	location := "file://" + blocklistPath
+	content := []byte("title = \"AGBTest\"\ndescription = \"Testing only\"\nmaintainer = \"AdGoBye\"\n[[block]]\nfriendly_name = \"Test\"\nworld_id = \"wrld_00000000-0000-0000-0000-000000000000\"\ngame_objects = [{ name = \"Poster\" }]\n")
+	err := os.WriteFile(blocklistPath, content, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, results, _ := GenerateObjectIndex([]string{location})
+	assert.Equal(t, []SourceResult{{Location: location, Bytes: len(content), Worlds: 1, Objects: 1, Revision: contentRevision(content)}}, results)
+
+	if err = os.Remove(blocklistPath); err != nil {
+		t.Fatal(err)
+	}
+	mapping, results, blocklists := GenerateObjectIndex([]string{location, "file:///notafile"})
+	assert.Len(t, mapping, 1, "cached copy should still be indexed")
+	assert.Equal(t, []*BlocklistInfo{{Title: "AGBTest", Description: "Testing only", Maintainer: "AdGoBye", Source: location, Revision: contentRevision(content)}},
+		blocklists, "cached copy should keep its metadata and revision")
+	assert.True(t, results[0].FromCache)
+	assert.NotEmpty(t, results[0].Error, "failure should be recorded even if the cache stood in")
+	assert.False(t, results[1].FromCache)
+	assert.NotEmpty(t, results[1].Error)
+}
@@ -0,0 +1,100 @@
+package Processing
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// WorldSummary describes a world in the index without its objects.
+type WorldSummary struct {
+	WorldId      string
+	FriendlyName string
+	Objects      int
+	// Blocklists lists the title of every blocklist contributing objects to this world.
+	Blocklists []string
+}
+
+// IndexedObject is an object in the index together with the hash clients report it by.
+type IndexedObject struct {
+	Hash      string
+	WorldId   string
+	World     string
+	Blocklist string
+	Name      string
+	Position  *GameobjectPosition
+	Parent    *Gameobject
+}
+
+// Worlds summarizes every world in the index, ordered by friendly name.
+func (index WorldObjectIndex) Worlds() []WorldSummary {
+	worlds := make([]WorldSummary, 0, len(index.Index))
+	for worldId, world := range index.Index {
+		summary := WorldSummary{WorldId: worldId, FriendlyName: world.FriendlyName, Objects: len(world.GameObjectMapping)}
+		for _, object := range world.GameObjectMapping {
+			if object.ParentBlocklist != nil && !slices.Contains(summary.Blocklists, object.ParentBlocklist.Title) {
+				summary.Blocklists = append(summary.Blocklists, object.ParentBlocklist.Title)
+			}
+		}
+		slices.Sort(summary.Blocklists)
+		worlds = append(worlds, summary)
+	}
+	slices.SortFunc(worlds, func(a, b WorldSummary) int {
+		return cmp.Or(cmp.Compare(a.FriendlyName, b.FriendlyName), cmp.Compare(a.WorldId, b.WorldId))
+	})
+	return worlds
+}
+
+// Objects returns every object of the world hashed as worldId, ordered by name. ok is false if there is no such world.
+func (index WorldObjectIndex) Objects(worldId string) (objects []IndexedObject, ok bool) {
+	world, exists := index.Index[worldId]
+	if !exists {
+		return nil, false
+	}
+	objects = make([]IndexedObject, 0, len(world.GameObjectMapping))
+	for hash, object := range world.GameObjectMapping {
+		objects = append(objects, newIndexedObject(worldId, world, hash, object))
+	}
+	sortIndexedObjects(objects)
+	return objects, true
+}
+
+// SearchObjects returns up to limit objects whose name contains name, ignoring case. A limit of 0 returns all of them.
+func (index WorldObjectIndex) SearchObjects(name string, limit int) []IndexedObject {
+	name = strings.ToLower(name)
+	var objects []IndexedObject
+	for worldId, world := range index.Index {
+		for hash, object := range world.GameObjectMapping {
+			if strings.Contains(strings.ToLower(object.Name), name) {
+				objects = append(objects, newIndexedObject(worldId, world, hash, object))
+			}
+		}
+	}
+	sortIndexedObjects(objects)
+	if limit > 0 && len(objects) > limit {
+		objects = objects[:limit]
+	}
+	return objects
+}
+
+func newIndexedObject(worldId string, world WorldObject, hash string, object Gameobject) IndexedObject {
+	indexed := IndexedObject{
+		Hash:     hash,
+		WorldId:  worldId,
+		World:    world.FriendlyName,
+		Name:     object.Name,
+		Position: object.Position,
+		Parent:   object.Parent,
+	}
+	if object.ParentBlocklist != nil {
+		indexed.Blocklist = object.ParentBlocklist.Title
+	}
+	return indexed
+}
+
+func sortIndexedObjects(objects []IndexedObject) {
+	slices.SortFunc(objects, func(a, b IndexedObject) int {
+		return cmp.Or(cmp.Compare(a.World, b.World), cmp.Compare(a.WorldId, b.WorldId),
+			cmp.Compare(a.Name, b.Name), cmp.Compare(a.Hash, b.Hash))
+	})
+}
@@ -0,0 +1,40 @@
+package Processing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWorldObjectIndex_Browse(t *testing.T) {
+	mapping := make(map[string]WorldObject)
+	indexBlocklist(mapping, Blocklist{Title: "AGBBase", Blocks: []Block{{
+		FriendlyName: "Just B Club 3",
+		WorldId:      "wrld_4cf554b4-430c-4f8f-b53e-1f294eed230b",
+		GameObjects:  []Gameobject{{Name: "Poster (9)"}, {Name: "TV Prefab UNIQUE"}},
+	}}}, SourceResult{})
+	indexBlocklist(mapping, Blocklist{Title: "AGBUpsell", Blocks: []Block{{
+		FriendlyName: "Just B Club 3",
+		WorldId:      "wrld_4cf554b4-430c-4f8f-b53e-1f294eed230b",
+		GameObjects:  []Gameobject{{Name: "Discord TV Ad (1)"}},
+	}}}, SourceResult{})
+	index := WorldObjectIndex{Index: mapping}
+	worldId := HashWorldId("wrld_4cf554b4-430c-4f8f-b53e-1f294eed230b")
+
+	assert.Equal(t, []WorldSummary{{WorldId: worldId, FriendlyName: "Just B Club 3", Objects: 3, Blocklists: []string{"AGBBase", "AGBUpsell"}}},
+		index.Worlds())
+
+	objects, ok := index.Objects(worldId)
+	if assert.True(t, ok) && assert.Len(t, objects, 3) {
+		assert.Equal(t, IndexedObject{Hash: HashGameobject(Gameobject{Name: "Discord TV Ad (1)"}), WorldId: worldId,
+			World: "Just B Club 3", Blocklist: "AGBUpsell", Name: "Discord TV Ad (1)"}, objects[0])
+	}
+	_, ok = index.Objects("unknown")
+	assert.False(t, ok)
+
+	found := index.SearchObjects("tv", 0)
+	if assert.Len(t, found, 2) {
+		assert.Equal(t, "Discord TV Ad (1)", found[0].Name)
+		assert.Equal(t, "TV Prefab UNIQUE", found[1].Name)
+	}
+	assert.Len(t, index.SearchObjects("tv", 1), 1)
+}
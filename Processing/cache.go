@@ -0,0 +1,96 @@
+package Processing
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// BlocklistCache keeps the last successfully parsed copy of every source on disk, so a source that fails to fetch
+// can still contribute to the index.
+type BlocklistCache struct {
+	mutex     sync.RWMutex
+	directory string
+}
+
+var (
+	// Cache is disabled until a directory is set.
+	Cache = &BlocklistCache{}
+
+	errCacheDisabled = errors.New("blocklist cache is disabled")
+)
+
+// CachedSource is the last known good copy of a source, with what it takes to verify and parse it again. It's kept as
+// a single file, so a copy can't end up next to the signature of another.
+type CachedSource struct {
+	Bytes []byte
+	// ContentType is what the copy was served with, see blocklistFormat.
+	ContentType string `json:",omitempty"`
+	// Signature is the detached signature the copy was verified with.
+	Signature []byte `json:",omitempty"`
+	// Commit is what git sources were read at.
+	Commit string `json:",omitempty"`
+}
+
+// SetDirectory changes where cached copies are kept, an empty directory disables the cache.
+func (cache *BlocklistCache) SetDirectory(directory string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.directory = directory
+}
+
+// Store saves cached as last known good copy of location.
+func (cache *BlocklistCache) Store(location string, cached CachedSource) error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.directory == "" {
+		return errCacheDisabled
+	}
+	encoded, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(cache.directory, 0755); err != nil {
+		return err
+	}
+	// Write next to the destination and rename, so a crash mid-write never leaves a torn copy behind
+	temporary, err := os.CreateTemp(cache.directory, ".source-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporary.Name())
+	if _, err = temporary.Write(encoded); err != nil {
+		temporary.Close()
+		return err
+	}
+	if err = temporary.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporary.Name(), cache.pathFor(location))
+}
+
+// Load returns the last known good copy of location.
+func (cache *BlocklistCache) Load(location string) (CachedSource, error) {
+	cache.mutex.RLock()
+	defer cache.mutex.RUnlock()
+	if cache.directory == "" {
+		return CachedSource{}, errCacheDisabled
+	}
+	encoded, err := os.ReadFile(cache.pathFor(location))
+	if err != nil {
+		return CachedSource{}, err
+	}
+	var cached CachedSource
+	if err = json.Unmarshal(encoded, &cached); err != nil {
+		return CachedSource{}, err
+	}
+	return cached, nil
+}
+
+func (cache *BlocklistCache) pathFor(location string) string {
+	return filepath.Join(cache.directory, hex.EncodeToString(stringToHash(location))+".source")
+}
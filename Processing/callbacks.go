@@ -0,0 +1,159 @@
+package Processing
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// CallbackContainerV2 is the callback sent by newer clients, it adds what we need to tell apart reports from
+// outdated clients or blocklists.
+type CallbackContainerV2 struct {
+	CallbackContainer
+	ClientVersion string `json:"ClientVersion"`
+	// BlocklistRevisions maps the title of every blocklist the client has loaded to the revision it has.
+	BlocklistRevisions map[string]string `json:"BlocklistRevisions"`
+	ReportedAt         time.Time         `json:"ReportedAt"`
+	// InstallId is an optional random identifier the client keeps for as long as it is installed.
+	InstallId string `json:"InstallId"`
+}
+
+// CallbackOptions is what callbacks are checked against besides their schema.
+type CallbackOptions struct {
+	// DeniedClientVersions lists client versions with known reporting bugs, their callbacks are refused.
+	DeniedClientVersions []string
+	// MaxUnmatchedObjects bounds how many objects a single callback may report, 0 means no limit.
+	MaxUnmatchedObjects int
+}
+
+// callbackSchema decodes and validates a single callback version.
+type callbackSchema struct {
+	decode   func(body []byte) (IncomingCallback, error)
+	validate func(callback IncomingCallback, options CallbackOptions) []InvalidParam
+}
+
+var callbackSchemas = map[int]callbackSchema{
+	1: {decode: decodeCallbackV1, validate: validateCallbackV1},
+	2: {decode: decodeCallbackV2, validate: validateCallbackV2},
+}
+
+// DecodeCallback decodes body with the schema its Version asks for. Errors are *Problem, so they can be
+// handed back to the client as they are.
+func DecodeCallback(body []byte, options CallbackOptions) (IncomingCallback, error) {
+	var versioned struct {
+		Version *int `json:"Version"`
+	}
+	if err := json.Unmarshal(body, &versioned); err != nil {
+		return IncomingCallback{}, NewProblem(fiber.StatusBadRequest, "malformed callback: "+err.Error())
+	}
+	if versioned.Version == nil {
+		return IncomingCallback{}, NewProblem(fiber.StatusBadRequest, "callback has no version")
+	}
+	schema, exists := callbackSchemas[*versioned.Version]
+	if !exists {
+		return IncomingCallback{}, NewProblem(fiber.StatusBadRequest, "unsupported callback version "+strconv.Itoa(*versioned.Version))
+	}
+
+	callback, err := schema.decode(body)
+	if err != nil {
+		return IncomingCallback{}, NewProblem(fiber.StatusBadRequest, "malformed callback: "+err.Error())
+	}
+	if invalid := schema.validate(callback, options); len(invalid) > 0 {
+		problem := NewProblem(fiber.StatusUnprocessableEntity, "callback failed validation")
+		problem.InvalidParams = invalid
+		return IncomingCallback{}, problem
+	}
+	if callback.ClientVersion != "" && slices.Contains(options.DeniedClientVersions, callback.ClientVersion) {
+		return IncomingCallback{}, NewProblem(fiber.StatusForbidden, "client version "+callback.ClientVersion+" is known to misreport, please update")
+	}
+	return callback, nil
+}
+
+// maxReportedInvalidObjects keeps a callback full of garbage from producing an equally large problem.
+const maxReportedInvalidObjects = 10
+
+// isEncodedHash reports whether value is a hash the way clients send them, base64 of a SHA-256 digest.
+func isEncodedHash(value string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	return err == nil && len(decoded) == sha256.Size
+}
+
+func decodeCallbackV1(body []byte) (IncomingCallback, error) {
+	var container CallbackContainer
+	if err := json.Unmarshal(body, &container); err != nil {
+		return IncomingCallback{}, err
+	}
+	return IncomingCallback{CallbackContainer: container, ReceivedAt: time.Now()}, nil
+}
+
+func validateCallbackV1(callback IncomingCallback, options CallbackOptions) (invalid []InvalidParam) {
+	switch {
+	case callback.WorldId == "":
+		invalid = append(invalid, InvalidParam{Name: "WorldId", Reason: "missing"})
+	case !isEncodedHash(callback.WorldId):
+		invalid = append(invalid, InvalidParam{Name: "WorldId", Reason: "not a base64 encoded SHA-256 hash"})
+	}
+
+	if options.MaxUnmatchedObjects > 0 && len(callback.UnmatchedObjects) > options.MaxUnmatchedObjects {
+		return append(invalid, InvalidParam{
+			Name:   "UnmatchedObjects",
+			Reason: "more than " + strconv.Itoa(options.MaxUnmatchedObjects) + " objects",
+		})
+	}
+	reportedObjects := 0
+	for i, object := range callback.UnmatchedObjects {
+		if isEncodedHash(object) {
+			continue
+		}
+		if reportedObjects++; reportedObjects > maxReportedInvalidObjects {
+			break
+		}
+		invalid = append(invalid, InvalidParam{
+			Name:   "UnmatchedObjects[" + strconv.Itoa(i) + "]",
+			Reason: "not a base64 encoded SHA-256 hash",
+		})
+	}
+	return invalid
+}
+
+func decodeCallbackV2(body []byte) (IncomingCallback, error) {
+	var container CallbackContainerV2
+	if err := json.Unmarshal(body, &container); err != nil {
+		return IncomingCallback{}, err
+	}
+	return IncomingCallback{
+		CallbackContainer:  container.CallbackContainer,
+		ClientVersion:      container.ClientVersion,
+		BlocklistRevisions: container.BlocklistRevisions,
+		ReportedAt:         container.ReportedAt,
+		InstallId:          container.InstallId,
+		ReceivedAt:         time.Now(),
+	}, nil
+}
+
+// maxInstallIdLength is generous for a UUID in any notation, but keeps clients from stuffing whatever they like in there.
+const maxInstallIdLength = 64
+
+// maxClockSkew is how far into the future a client's ReportedAt may lie before we stop believing it.
+const maxClockSkew = 10 * time.Minute
+
+func validateCallbackV2(callback IncomingCallback, options CallbackOptions) []InvalidParam {
+	invalid := validateCallbackV1(callback, options)
+	if callback.ClientVersion == "" {
+		invalid = append(invalid, InvalidParam{Name: "ClientVersion", Reason: "missing"})
+	}
+	switch {
+	case callback.ReportedAt.IsZero():
+		invalid = append(invalid, InvalidParam{Name: "ReportedAt", Reason: "missing"})
+	case callback.ReportedAt.After(callback.ReceivedAt.Add(maxClockSkew)):
+		invalid = append(invalid, InvalidParam{Name: "ReportedAt", Reason: "lies in the future"})
+	}
+	if len(callback.InstallId) > maxInstallIdLength {
+		invalid = append(invalid, InvalidParam{Name: "InstallId", Reason: "longer than " + strconv.Itoa(maxInstallIdLength) + " characters"})
+	}
+	return invalid
+}
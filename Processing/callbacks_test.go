@@ -0,0 +1,97 @@
+package Processing
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeCallback(t *testing.T) {
+	options := CallbackOptions{DeniedClientVersions: []string{"1.2.0"}, MaxUnmatchedObjects: 2}
+	world := base64.StdEncoding.EncodeToString(stringToHash("wrld_4cf554b4-430c-4f8f-b53e-1f294eed230b"))
+	object := base64.StdEncoding.EncodeToString(stringToHash("object"))
+	// Every body below names the world as "world" and its objects as "object" for readability
+	expand := strings.NewReplacer(`"world"`, `"`+world+`"`, `"object"`, `"`+object+`"`)
+	tests := []struct {
+		name       string
+		body       string
+		want       IncomingCallback
+		wantStatus int
+	}{
+		{
+			name: "v1",
+			body: `{"Version": 1, "WorldId": "world", "UnmatchedObjects": ["object"]}`,
+			want: IncomingCallback{CallbackContainer: CallbackContainer{Version: 1, WorldId: world, UnmatchedObjects: []string{object}}},
+		},
+		{
+			name: "v2",
+			body: `{"Version": 2, "WorldId": "world", "UnmatchedObjects": ["object"], "ClientVersion": "2.0.0",
+				"BlocklistRevisions": {"AGBBase": "5646b6d"}, "ReportedAt": "2024-06-01T12:00:00Z",
+				"InstallId": "0b5e3b1c-5d1e-4d8e-9b0e-3f3a4f1c2d7a"}`,
+			want: IncomingCallback{
+				CallbackContainer:  CallbackContainer{Version: 2, WorldId: world, UnmatchedObjects: []string{object}},
+				ClientVersion:      "2.0.0",
+				BlocklistRevisions: map[string]string{"AGBBase": "5646b6d"},
+				ReportedAt:         time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+				InstallId:          "0b5e3b1c-5d1e-4d8e-9b0e-3f3a4f1c2d7a",
+			},
+		},
+		{name: "malformed", body: `{"Version": 1,`, wantStatus: fiber.StatusBadRequest},
+		{name: "no version", body: `{"WorldId": "world"}`, wantStatus: fiber.StatusBadRequest},
+		{name: "unknown version", body: `{"Version": 3, "WorldId": "world"}`, wantStatus: fiber.StatusBadRequest},
+		{name: "v1 without world", body: `{"Version": 1, "UnmatchedObjects": []}`, wantStatus: fiber.StatusUnprocessableEntity},
+		{name: "unhashed world", body: `{"Version": 1, "WorldId": "wrld_4cf554b4"}`, wantStatus: fiber.StatusUnprocessableEntity},
+		{
+			name:       "world hashed with something else",
+			body:       `{"Version": 1, "WorldId": "` + base64.StdEncoding.EncodeToString([]byte("too short")) + `"}`,
+			wantStatus: fiber.StatusUnprocessableEntity,
+		},
+		{name: "malformed object", body: `{"Version": 1, "WorldId": "world", "UnmatchedObjects": ["object", "Cube"]}`, wantStatus: fiber.StatusUnprocessableEntity},
+		{
+			name:       "too many objects",
+			body:       `{"Version": 1, "WorldId": "world", "UnmatchedObjects": ["object", "object", "object"]}`,
+			wantStatus: fiber.StatusUnprocessableEntity,
+		},
+		{
+			name:       "v2 without client version",
+			body:       `{"Version": 2, "WorldId": "world", "ReportedAt": "2024-06-01T12:00:00Z"}`,
+			wantStatus: fiber.StatusUnprocessableEntity,
+		},
+		{
+			name:       "v2 from the future",
+			body:       `{"Version": 2, "WorldId": "world", "ClientVersion": "2.0.0", "ReportedAt": "2999-01-01T00:00:00Z"}`,
+			wantStatus: fiber.StatusUnprocessableEntity,
+		},
+		{
+			name: "v2 with oversized install id",
+			body: `{"Version": 2, "WorldId": "world", "ClientVersion": "2.0.0", "ReportedAt": "2024-06-01T12:00:00Z",
+				"InstallId": "` + strings.Repeat("a", 65) + `"}`,
+			wantStatus: fiber.StatusUnprocessableEntity,
+		},
+		{
+			name:       "deny-listed client",
+			body:       `{"Version": 2, "WorldId": "world", "ClientVersion": "1.2.0", "ReportedAt": "2024-06-01T12:00:00Z"}`,
+			wantStatus: fiber.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeCallback([]byte(expand.Replace(tt.body)), options)
+			if tt.wantStatus != 0 {
+				var problem *Problem
+				if assert.True(t, errors.As(err, &problem), "DecodeCallback() error = %v, want *Problem", err) {
+					assert.Equal(t, tt.wantStatus, problem.Status)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.WithinDuration(t, time.Now(), got.ReceivedAt, time.Minute)
+			got.ReceivedAt = time.Time{}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
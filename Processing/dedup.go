@@ -0,0 +1,116 @@
+package Processing
+
+import (
+	"AGB-BlocklistSrv/Metrics"
+	"github.com/gofiber/fiber/v2/log"
+	"sync"
+	"time"
+)
+
+// Deduplicator is a MissFilter holding back misses a reporter already reported for the same world within a window.
+// How many were held back is passed on with the next miss that makes it through.
+//
+// It remembers up to maxEntries misses, the least recently reported are forgotten first. When a miss that had reports
+// held back is forgotten, or a window passes without it being reported again, the held back reports are passed on
+// on their own.
+type Deduplicator struct {
+	mutex   sync.Mutex
+	window  time.Duration
+	entries *boundedLRU[dedupKey, *dedupEntry]
+	// deliver passes on held back reports nothing else would carry, it's swapped out in tests.
+	deliver func(MissReport)
+}
+
+type dedupKey struct {
+	reporter, world, object string
+}
+
+type dedupEntry struct {
+	forwardedAt time.Time
+	suppressed  uint64
+	// held is the latest report held back and reportedAt when the miss was last reported at all
+	held       Miss
+	reportedAt time.Time
+}
+
+func NewDeduplicator(window time.Duration, maxEntries int) *Deduplicator {
+	dedup := &Deduplicator{
+		window:  window,
+		entries: newBoundedLRU[dedupKey, *dedupEntry](maxEntries),
+		deliver: deliverHeldBack,
+	}
+	dedup.entries.onEvict = dedup.passOnHeldBack
+	return dedup
+}
+
+func (dedup *Deduplicator) Filter(callback IncomingCallback, misses []Miss) []Miss {
+	if callback.Reporter == "" { // Without knowing who reported, every report might be someone else's
+		return misses
+	}
+	dedup.mutex.Lock()
+	defer dedup.mutex.Unlock()
+	dedup.expire(callback.ReceivedAt)
+
+	forwarded := make([]Miss, 0, len(misses))
+	for _, miss := range misses {
+		key := dedupKey{reporter: callback.Reporter, world: callback.WorldId, object: miss.Hash}
+		entry, exists := dedup.entries.get(key)
+		if !exists {
+			dedup.entries.add(key, &dedupEntry{forwardedAt: callback.ReceivedAt, reportedAt: callback.ReceivedAt})
+			forwarded = append(forwarded, miss)
+			continue
+		}
+
+		entry.reportedAt = callback.ReceivedAt
+		if callback.ReceivedAt.Sub(entry.forwardedAt) < dedup.window {
+			entry.suppressed++
+			entry.held = miss
+			Metrics.MissesSuppressed.Inc()
+			continue
+		}
+		miss.Suppressed += entry.suppressed
+		entry.suppressed = 0
+		entry.forwardedAt = callback.ReceivedAt
+		forwarded = append(forwarded, miss)
+	}
+	return forwarded
+}
+
+// expire forgets misses that weren't reported for a whole window, passing on what they held back. Entries are
+// ordered by when they were last reported, so it stops at the first one still within its window.
+func (dedup *Deduplicator) expire(now time.Time) {
+	for {
+		key, entry, exists := dedup.entries.oldest()
+		if !exists || now.Sub(entry.reportedAt) < dedup.window {
+			return
+		}
+		dedup.entries.remove(key)
+		dedup.passOnHeldBack(key, entry)
+	}
+}
+
+// passOnHeldBack delivers the reports entry held back as a single miss, the first carrying the count of the rest.
+func (dedup *Deduplicator) passOnHeldBack(key dedupKey, entry *dedupEntry) {
+	if entry.suppressed == 0 {
+		return
+	}
+	miss := entry.held
+	miss.Suppressed = entry.suppressed - 1
+	dedup.deliver(MissReport{WorldId: key.world, Misses: []Miss{miss}, ReceivedAt: entry.reportedAt})
+}
+
+func deliverHeldBack(report MissReport) {
+	if report.World = Index.Snapshot().GetWorldById(report.WorldId); report.World == nil {
+		log.Infof("Dropping %d held back reports of %s, world %s is no longer indexed",
+			report.Misses[0].Suppressed+1, report.Misses[0].Name, report.WorldId)
+		return
+	}
+	Receivers().Deliver(report)
+}
+
+// Len returns how many misses are currently remembered.
+func (dedup *Deduplicator) Len() int {
+	dedup.mutex.Lock()
+	defer dedup.mutex.Unlock()
+	return dedup.entries.len()
+}
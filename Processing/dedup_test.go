@@ -0,0 +1,110 @@
+package Processing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestDeduplicator(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	callback := func(reporter string, after time.Duration) IncomingCallback {
+		return IncomingCallback{
+			CallbackContainer: CallbackContainer{WorldId: "world"},
+			Reporter:          reporter,
+			ReceivedAt:        start.Add(after),
+		}
+	}
+	misses := []Miss{{Gameobject: Gameobject{Name: "Cube"}, Hash: "cube"}, {Gameobject: Gameobject{Name: "Sphere"}, Hash: "sphere"}}
+
+	dedup := NewDeduplicator(time.Hour, 0)
+	assert.Len(t, dedup.Filter(callback("alice", 0), misses), 2, "first report should pass")
+	assert.Empty(t, dedup.Filter(callback("alice", time.Minute), misses), "repeated report should be held back")
+	assert.Empty(t, dedup.Filter(callback("alice", 2*time.Minute), misses[:1]), "repeated report should be held back")
+	assert.Len(t, dedup.Filter(callback("bob", time.Minute), misses), 2, "other reporters should pass")
+	assert.Len(t, dedup.Filter(callback("", time.Minute), misses), 2, "unknown reporters can't be deduplicated")
+
+	forwarded := dedup.Filter(callback("alice", time.Hour), misses)
+	if assert.Len(t, forwarded, 2, "report after the window should pass") {
+		assert.Equal(t, uint64(2), forwarded[0].Suppressed)
+		assert.Equal(t, uint64(1), forwarded[1].Suppressed)
+	}
+	assert.Zero(t, misses[0].Suppressed, "filter must not modify misses in place")
+}
+
+func TestDeduplicatorBoundsEntries(t *testing.T) {
+	dedup := NewDeduplicator(time.Hour, 2)
+	now := time.Now()
+	for _, object := range []string{"cube", "sphere", "cylinder"} {
+		dedup.Filter(IncomingCallback{Reporter: "alice", ReceivedAt: now}, []Miss{{Hash: object}})
+	}
+	assert.Equal(t, 2, dedup.Len())
+	forwarded := dedup.Filter(IncomingCallback{Reporter: "alice", ReceivedAt: now}, []Miss{{Hash: "cube"}})
+	assert.Len(t, forwarded, 1, "forgotten miss should pass again")
+}
+
+func TestDeduplicatorPassesOnHeldBack(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	callback := func(reporter string, after time.Duration) IncomingCallback {
+		return IncomingCallback{
+			CallbackContainer: CallbackContainer{WorldId: "world"},
+			Reporter:          reporter,
+			ReceivedAt:        start.Add(after),
+		}
+	}
+	cube, sphere := Miss{Gameobject: Gameobject{Name: "Cube"}, Hash: "cube"}, Miss{Gameobject: Gameobject{Name: "Sphere"}, Hash: "sphere"}
+	heldBack := func(at time.Duration, suppressed uint64) MissReport {
+		cube := cube
+		cube.Suppressed = suppressed
+		return MissReport{WorldId: "world", Misses: []Miss{cube}, ReceivedAt: start.Add(at)}
+	}
+
+	tests := []struct {
+		name       string
+		maxEntries int
+		reports    []IncomingCallback
+		misses     [][]Miss
+		want       []MissReport
+	}{
+		{
+			name:    "window passes without another report",
+			reports: []IncomingCallback{callback("alice", 0), callback("alice", time.Minute), callback("alice", 2*time.Minute), callback("bob", 2*time.Hour)},
+			misses:  [][]Miss{{cube}, {cube}, {cube}, {sphere}},
+			want:    []MissReport{heldBack(2*time.Minute, 1)},
+		},
+		{
+			name:       "held back miss is forgotten",
+			maxEntries: 1,
+			reports:    []IncomingCallback{callback("alice", 0), callback("alice", time.Minute), callback("alice", 2*time.Minute)},
+			misses:     [][]Miss{{cube}, {cube}, {sphere}},
+			want:       []MissReport{heldBack(time.Minute, 0)},
+		},
+		{
+			name:    "nothing held back",
+			reports: []IncomingCallback{callback("alice", 0), callback("bob", 2*time.Hour)},
+			misses:  [][]Miss{{cube}, {sphere}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dedup := NewDeduplicator(time.Hour, tt.maxEntries)
+			var delivered []MissReport
+			dedup.deliver = func(report MissReport) { delivered = append(delivered, report) }
+			for i, report := range tt.reports {
+				dedup.Filter(report, tt.misses[i])
+			}
+			assert.Equal(t, tt.want, delivered)
+		})
+	}
+}
+
+func TestReporterFromAddress(t *testing.T) {
+	v4 := ReporterFromAddress(netip.MustParseAddr("192.0.2.1"))
+	assert.NotEmpty(t, v4)
+	assert.Equal(t, v4, ReporterFromAddress(netip.MustParseAddr("::ffff:192.0.2.1")))
+	assert.NotEqual(t, v4, ReporterFromAddress(netip.MustParseAddr("192.0.2.2")))
+	assert.Equal(t, ReporterFromAddress(netip.MustParseAddr("2001:db8::1")), ReporterFromAddress(netip.MustParseAddr("2001:db8::2")),
+		"addresses from the same /64 should be the same reporter")
+	assert.Empty(t, ReporterFromAddress(netip.Addr{}))
+}
@@ -0,0 +1,191 @@
+package Processing
+
+import (
+	"AGB-BlocklistSrv/Metrics"
+	"fmt"
+	"github.com/gofiber/fiber/v2/log"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MissReport is what one callback amounts to once it's been matched against the index.
+type MissReport struct {
+	World *WorldObject
+	// WorldId is the hashed world ID the callback was for.
+	WorldId    string
+	Misses     []Miss
+	ReceivedAt time.Time
+}
+
+// Miss is a blocklist entry a client reported as unmatched.
+type Miss struct {
+	Gameobject
+	// Hash is the object hash the client reported.
+	Hash string
+	// Suppressed counts identical reports that were held back instead of being passed on one by one.
+	Suppressed uint64
+	// Reporters is how many distinct reporters reported this miss within the quorum window, 0 without quorum.
+	Reporters int
+}
+
+// NamedReceiver pairs a Receiver with the name it was configured as.
+type NamedReceiver struct {
+	Name     string
+	Receiver Receiver
+}
+
+// ReceiverStats describes how deliveries to a single receiver are going.
+type ReceiverStats struct {
+	Name      string
+	Queued    int
+	Capacity  int
+	Delivered uint64
+	Failed    uint64
+	// Dropped counts reports that never made it into the queue because it was full.
+	Dropped uint64
+}
+
+// Fanout hands every report to all of its receivers. Each receiver has its own queue and worker, so a slow or
+// failing receiver only ever holds up itself.
+type Fanout struct {
+	queues  []*receiverQueue
+	workers sync.WaitGroup
+	// closing guards against Deliver racing Close, callbacks may still hold a fanout that was just swapped out
+	closing sync.RWMutex
+	closed  bool
+}
+
+type receiverQueue struct {
+	NamedReceiver
+	queue     chan MissReport
+	delivered atomic.Uint64
+	failed    atomic.Uint64
+	dropped   atomic.Uint64
+	// full is set from the first report dropped until the worker emptied the queue, so every overflow is logged once
+	full atomic.Bool
+	// timesWrites is set for AsyncWriteTimers, for which SendToRemote only takes as long as queueing a report
+	timesWrites bool
+}
+
+func NewFanout(receivers []NamedReceiver, queueSize int) *Fanout {
+	fanout := &Fanout{}
+	for _, receiver := range receivers {
+		queue := &receiverQueue{NamedReceiver: receiver, queue: make(chan MissReport, queueSize)}
+		if reporter, ok := receiver.Receiver.(AsyncErrorReporter); ok {
+			reporter.SetErrorCallback(func(err error) {
+				queue.failed.Add(1)
+				Metrics.ReceiverWriteErrors.WithLabelValues(queue.Name).Inc()
+				log.Errorf("Receiver %s failed to deliver misses: %s", queue.Name, err.Error())
+			})
+		}
+		if timer, ok := receiver.Receiver.(AsyncWriteTimer); ok {
+			queue.timesWrites = true
+			timer.SetWriteCallback(func(took time.Duration) {
+				Metrics.ReceiverWriteDuration.WithLabelValues(queue.Name).Observe(took.Seconds())
+			})
+		}
+		fanout.queues = append(fanout.queues, queue)
+		fanout.workers.Add(1)
+		go func() {
+			defer fanout.workers.Done()
+			queue.work()
+		}()
+	}
+	return fanout
+}
+
+// Deliver queues report for every receiver without blocking. Receivers whose queue is full drop it,
+// as do all receivers once the fanout is closed.
+func (fanout *Fanout) Deliver(report MissReport) {
+	fanout.closing.RLock()
+	defer fanout.closing.RUnlock()
+	for _, queue := range fanout.queues {
+		if fanout.closed {
+			queue.dropped.Add(1)
+			Metrics.ReceiverDropped.WithLabelValues(queue.Name).Inc()
+			continue
+		}
+		select {
+		case queue.queue <- report:
+		default:
+			Metrics.ReceiverDropped.WithLabelValues(queue.Name).Inc()
+			queue.dropped.Add(1)
+			if queue.full.CompareAndSwap(false, true) {
+				log.Warnf("Queue for receiver %s is full, dropping reports until it catches up", queue.Name)
+			}
+		}
+	}
+}
+
+// Stats returns the current delivery statistics of every receiver.
+func (fanout *Fanout) Stats() []ReceiverStats {
+	stats := make([]ReceiverStats, 0, len(fanout.queues))
+	for _, queue := range fanout.queues {
+		stats = append(stats, ReceiverStats{
+			Name:      queue.Name,
+			Queued:    len(queue.queue),
+			Capacity:  cap(queue.queue),
+			Delivered: queue.delivered.Load(),
+			Failed:    queue.failed.Load(),
+			Dropped:   queue.dropped.Load(),
+		})
+	}
+	return stats
+}
+
+// Close stops accepting reports and waits until every receiver worked through its queue.
+// Receivers implementing io.Closer are closed afterwards, so they can flush whatever they buffered.
+func (fanout *Fanout) Close() {
+	fanout.closing.Lock()
+	if fanout.closed {
+		fanout.closing.Unlock()
+		fanout.workers.Wait()
+		return
+	}
+	fanout.closed = true
+	for _, queue := range fanout.queues {
+		close(queue.queue)
+	}
+	fanout.closing.Unlock()
+	fanout.workers.Wait()
+
+	for _, queue := range fanout.queues {
+		if closer, ok := queue.Receiver.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Errorf("Failed to close receiver %s: %s", queue.Name, err.Error())
+			}
+		}
+	}
+}
+
+func (queue *receiverQueue) work() {
+	for report := range queue.queue {
+		sendStarted := time.Now()
+		err := queue.send(report)
+		if !queue.timesWrites {
+			Metrics.ReceiverWriteDuration.WithLabelValues(queue.Name).Observe(time.Since(sendStarted).Seconds())
+		}
+		if len(queue.queue) == 0 && queue.full.CompareAndSwap(true, false) {
+			log.Infof("Queue for receiver %s caught up, %d reports were dropped so far", queue.Name, queue.dropped.Load())
+		}
+		if err != nil {
+			queue.failed.Add(1)
+			Metrics.ReceiverWriteErrors.WithLabelValues(queue.Name).Inc()
+			log.Errorf("Receiver %s failed to deliver misses for %s: %s", queue.Name, report.World.FriendlyName, err.Error())
+			continue
+		}
+		queue.delivered.Add(1)
+	}
+}
+
+// send keeps a panicking receiver from taking the whole server down with it.
+func (queue *receiverQueue) send(report MissReport) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("receiver panicked: %v", recovered)
+		}
+	}()
+	return queue.Receiver.SendToRemote(report)
+}
@@ -0,0 +1,71 @@
+package Processing
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type blockingReceiver struct{ release chan struct{} }
+
+func (receiver blockingReceiver) SendToRemote(MissReport) error {
+	<-receiver.release
+	return nil
+}
+
+type recordingReceiver struct {
+	reports chan MissReport
+	err     error
+}
+
+func (receiver recordingReceiver) SendToRemote(report MissReport) error {
+	receiver.reports <- report
+	return receiver.err
+}
+
+func TestFanout_SlowReceiverDoesNotHoldUpOthers(t *testing.T) {
+	slow := blockingReceiver{release: make(chan struct{})}
+	fast := recordingReceiver{reports: make(chan MissReport, 8)}
+	failing := recordingReceiver{reports: make(chan MissReport, 8), err: errors.New("remote is down")}
+	fanout := NewFanout([]NamedReceiver{{"slow", slow}, {"fast", fast}, {"failing", failing}}, 4)
+
+	world := &WorldObject{FriendlyName: "Test"}
+	// Two rounds that each fit a queue, the slow receiver is stuck on the first report the whole time
+	for range 2 {
+		for range 4 {
+			fanout.Deliver(MissReport{World: world})
+		}
+		for range 4 {
+			<-fast.reports
+			<-failing.reports
+		}
+	}
+	close(slow.release)
+	fanout.Close()
+
+	stats := fanout.Stats()
+	assert.Equal(t, "slow", stats[0].Name)
+	assert.GreaterOrEqual(t, stats[0].Dropped, uint64(3), "slow receiver should have dropped what didn't fit its queue")
+	assert.Equal(t, uint64(8), stats[0].Delivered+stats[0].Dropped)
+	assert.Equal(t, ReceiverStats{Name: "fast", Capacity: 4, Delivered: 8}, stats[1])
+	assert.Equal(t, ReceiverStats{Name: "failing", Capacity: 4, Failed: 8}, stats[2])
+
+	fanout.Deliver(MissReport{World: world})
+	assert.Equal(t, uint64(1), fanout.Stats()[1].Dropped, "delivering to a closed fanout should count as dropped")
+}
+
+func TestFanout_WarnsAgainAfterCatchingUp(t *testing.T) {
+	slow := blockingReceiver{release: make(chan struct{})}
+	fanout := NewFanout([]NamedReceiver{{"slow", slow}}, 1)
+	defer fanout.Close()
+	queue := fanout.queues[0]
+
+	for range 3 {
+		fanout.Deliver(MissReport{})
+	}
+	assert.True(t, queue.full.Load(), "dropping a report should mark the queue as full")
+	close(slow.release)
+	assert.Eventually(t, func() bool { return !queue.full.Load() }, time.Second, time.Millisecond,
+		"the queue should be warned about again once it drained")
+}
@@ -0,0 +1,68 @@
+package Processing
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Formats blocklists can be written in.
+const (
+	FormatTOML = "toml"
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// blocklistFormat decides which format the blocklist at location is in. A format configured for the source wins,
+// then a Content-Type naming one, then the file extension. Anything else is taken to be TOML, which also covers
+// servers like raw.githubusercontent.com that answer with text/plain for everything.
+func blocklistFormat(location string, contentType string) string {
+	if format := sourceOptionsFor(location).Format; format != "" {
+		return format
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return FormatJSON
+	case mediaType == "application/yaml" || mediaType == "application/x-yaml" || mediaType == "text/yaml" ||
+		mediaType == "text/x-yaml":
+		return FormatYAML
+	case mediaType == "application/toml":
+		return FormatTOML
+	}
+
+	if uri, err := url.Parse(location); err == nil {
+		switch strings.ToLower(path.Ext(sourcePath(uri))) {
+		case ".json":
+			return FormatJSON
+		case ".yaml", ".yml":
+			return FormatYAML
+		}
+	}
+	return FormatTOML
+}
+
+func decodeBlocklist(blocklistBytes []byte, format string) (Blocklist, error) {
+	var blocklistObject Blocklist
+	var err error
+	switch format {
+	case FormatTOML:
+		err = toml.Unmarshal(blocklistBytes, &blocklistObject)
+	case FormatJSON:
+		err = json.Unmarshal(blocklistBytes, &blocklistObject)
+	case FormatYAML:
+		err = yaml.Unmarshal(blocklistBytes, &blocklistObject)
+	default:
+		err = errors.New("unsupported blocklist format: " + format)
+	}
+	if err != nil {
+		return Blocklist{}, err
+	}
+	return blocklistObject, nil
+}
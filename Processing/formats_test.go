@@ -0,0 +1,150 @@
+package Processing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	tomlBlocklist = `title = "AGBTest"
+maintainer = "AdGoBye"
+
+[[block]]
+friendly_name = "Prison Escape!"
+world_id = "wrld_14750dd6-26a1-4edb-ae67-cac5bcd9ed6a"
+game_objects = [
+    { name = "Group Sign" },
+    { name = "Image (3)", position = { x = -175.0, y = -175.0, z = 0.0 }, parent = { name = "Panel" } },
+]
+`
+	jsonBlocklist = `{
+  "title": "AGBTest",
+  "maintainer": "AdGoBye",
+  "block": [{
+    "friendly_name": "Prison Escape!",
+    "world_id": "wrld_14750dd6-26a1-4edb-ae67-cac5bcd9ed6a",
+    "game_objects": [
+      {"name": "Group Sign"},
+      {"name": "Image (3)", "position": {"x": -175, "y": -175, "z": 0}, "parent": {"name": "Panel"}}
+    ]
+  }]
+}`
+	yamlBlocklist = `title: AGBTest
+maintainer: AdGoBye
+block:
+  - friendly_name: Prison Escape!
+    world_id: wrld_14750dd6-26a1-4edb-ae67-cac5bcd9ed6a
+    game_objects:
+      - name: Group Sign
+      - name: Image (3)
+        position: {x: -175, y: -175, z: 0}
+        parent: {name: Panel}
+`
+)
+
+func Test_decodeBlocklist(t *testing.T) {
+	want, err := decodeBlocklist([]byte(tomlBlocklist), FormatTOML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHashes := HashBlocklist(want)
+	// Known from the AGBCommunity list, so a regression in TOML itself would show too
+	assert.Equal(t, "/JIRSiPxW8PbT3/6hiteuy19SvYXKRkiOF000vaz4IA=", wantHashes[0].Objects[1].Hash)
+
+	tests := []struct {
+		name    string
+		content string
+		format  string
+		wantErr bool
+	}{
+		{"json", jsonBlocklist, FormatJSON, false},
+		{"yaml", yamlBlocklist, FormatYAML, false},
+		{"json read as yaml", jsonBlocklist, FormatYAML, false}, // JSON is valid YAML
+		{"toml read as json", tomlBlocklist, FormatJSON, true},
+		{"unknown format", tomlBlocklist, "ini", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeBlocklist([]byte(tt.content), tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeBlocklist() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			assert.Equal(t, want, got)
+			assert.Equal(t, wantHashes, HashBlocklist(got), "equivalent content has to hash the same in every format")
+		})
+	}
+}
+
+func Test_blocklistFormat(t *testing.T) {
+	SetSourceOptions(map[string]SourceOptions{"https://example.com/configured.toml": {Format: FormatYAML}})
+	defer SetSourceOptions(nil)
+
+	tests := []struct {
+		name        string
+		location    string
+		contentType string
+		want        string
+	}{
+		{"configured format wins", "https://example.com/configured.toml", "application/json", FormatYAML},
+		{"content type", "https://example.com/generated", "application/json; charset=utf-8", FormatJSON},
+		{"structured suffix", "https://example.com/generated", "application/blocklist+json", FormatJSON},
+		{"yaml content type", "https://example.com/generated", "application/yaml", FormatYAML},
+		{"content type over extension", "https://example.com/list.json", "application/toml", FormatTOML},
+		{"extension when served as text", "https://example.com/list.json", "text/plain; charset=utf-8", FormatJSON},
+		{"yml extension", "file:///srv/lists/AGBTest.YML", "", FormatYAML},
+		{"extension ignores query", "https://example.com/list.yaml?token=1", "", FormatYAML},
+		{"git path", "git+file:///srv/blocklists?ref=main&path=lists/AGBTest.yaml", "", FormatYAML},
+		{"defaults to toml", "https://example.com/generated", "application/octet-stream", FormatTOML},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, blocklistFormat(tt.location, tt.contentType))
+		})
+	}
+}
+
+func Test_loadSourceDetectsContentType(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(jsonBlocklist))
+	}))
+	defer server.Close()
+
+	mapping, results, _ := GenerateObjectIndex([]string{server.URL + "/generated"})
+	assert.Empty(t, results[0].Error)
+	assert.Len(t, mapping[HashWorldId("wrld_14750dd6-26a1-4edb-ae67-cac5bcd9ed6a")].GameObjectMapping, 2)
+}
+
+func Test_loadSourceReparsesWhenFormatChanges(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(jsonBlocklist))
+	}))
+	defer server.Close()
+	location := server.URL + "/generated"
+	defer SetSourceOptions(nil)
+
+	load := func(format string) SourceResult {
+		SetSourceOptions(map[string]SourceOptions{location: {Format: format}})
+		_, result, _ := loadSource(location)
+		return result
+	}
+	assert.Empty(t, load(FormatYAML).Error)
+	assert.True(t, load(FormatYAML).NotModified)
+
+	result := load(FormatJSON)
+	assert.Empty(t, result.Error)
+	assert.False(t, result.NotModified, "a copy parsed as another format mustn't be reused")
+	assert.Positive(t, result.Bytes)
+	assert.True(t, load(FormatJSON).NotModified)
+	assert.NotEmpty(t, load(FormatTOML).Error, "JSON read as TOML should fail even though the server says it's unchanged")
+}
@@ -0,0 +1,269 @@
+package Processing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gitScheme locates a blocklist in a local git repository, like
+// git+file:///srv/blocklists?ref=main&path=AGBBase.toml. ref is a branch, tag or commit and defaults to HEAD.
+const gitScheme = "git+file"
+
+// gitSource is a parsed git+file location.
+type gitSource struct {
+	repository string
+	ref        string
+	path       string
+}
+
+func parseGitLocation(uri *url.URL) (gitSource, error) {
+	query := uri.Query()
+	source := gitSource{repository: uri.Path, ref: query.Get("ref"), path: strings.TrimPrefix(query.Get("path"), "/")}
+	if source.ref == "" {
+		source.ref = "HEAD"
+	}
+	switch {
+	case source.repository == "":
+		return gitSource{}, errors.New("git location has no repository path")
+	case source.path == "":
+		return gitSource{}, errors.New("git location " + uri.String() + " doesn't name a file with ?path=")
+	case strings.HasPrefix(source.ref, "-"):
+		return gitSource{}, errors.New("invalid git ref: " + source.ref)
+	}
+	return source, nil
+}
+
+// sourcePath returns the path of the file uri locates, which git locations have in their query.
+func sourcePath(uri *url.URL) string {
+	if uri.Scheme == gitScheme {
+		return uri.Query().Get("path")
+	}
+	return uri.Path
+}
+
+// pinKey is a ref as a git source names it, in the repository the source reads from.
+type pinKey struct {
+	repository string
+	ref        string
+}
+
+// pin is what a push webhook announced for a ref.
+type pin struct {
+	commit string
+	// pushedRef is the full name of the ref on the remote, like refs/heads/main.
+	pushedRef string
+}
+
+var (
+	pinnedCommits      = map[pinKey]pin{}
+	pinnedCommitsMutex sync.Mutex
+)
+
+// commitPattern matches full SHA-1 and SHA-256 commit IDs.
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{40}([0-9a-f]{24})?$`)
+
+// Push is what a push webhook announced.
+type Push struct {
+	// Remotes are the URLs of the pushed repository, local repositories with one of them as remote are clones of it.
+	Remotes []string
+	// Ref is the full name of the pushed ref, like refs/heads/main.
+	Ref string
+	// Commit is what Ref points to now, all zeros if it was deleted.
+	Commit string
+}
+
+// PinPush makes the git sources among locations that follow the pushed ref in a clone of the pushed repository read
+// the pushed commit, as soon as their repository has it and until their ref points to it or past it. The commit has to
+// be reachable from the pushed ref in the clone, or a remote-tracking branch of it, otherwise the pin is dropped, which
+// also happens once the ref was rewritten. It returns how many sources were pinned, a deleted ref removes their pins.
+//
+// Anyone able to send webhooks can pin, so only call this for webhooks that were authenticated.
+func PinPush(locations []string, push Push) (int, error) {
+	if !commitPattern.MatchString(push.Commit) {
+		return 0, errors.New("not a full commit ID: " + push.Commit)
+	}
+	pushed := make(map[string]bool, len(push.Remotes))
+	for _, remote := range push.Remotes {
+		if remote != "" {
+			pushed[remoteIdentity(remote)] = true
+		}
+	}
+
+	pinned := 0
+	for _, location := range locations {
+		uri, err := url.Parse(location)
+		if err != nil || uri.Scheme != gitScheme {
+			continue
+		}
+		source, err := parseGitLocation(uri)
+		if err != nil || !slices.Contains([]string{source.ref, "refs/heads/" + source.ref, "refs/tags/" + source.ref}, push.Ref) ||
+			!clonesAnyOf(source.repository, pushed) {
+			continue
+		}
+
+		pinnedCommitsMutex.Lock()
+		if strings.Trim(push.Commit, "0") == "" {
+			delete(pinnedCommits, pinKey{source.repository, source.ref})
+		} else {
+			pinnedCommits[pinKey{source.repository, source.ref}] = pin{commit: push.Commit, pushedRef: push.Ref}
+			pinned++
+		}
+		pinnedCommitsMutex.Unlock()
+	}
+	return pinned, nil
+}
+
+// clonesAnyOf tells whether repository has one of remotes, as returned by remoteIdentity, as remote.
+func clonesAnyOf(repository string, remotes map[string]bool) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	output, err := runGit(ctx, repository, "config", "--get-regexp", `^remote\..*\.url$`)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if _, remote, found := strings.Cut(line, " "); found && remotes[remoteIdentity(remote)] {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIdentity reduces a remote URL to host and path, so the https, ssh and scp-like URLs of a repository compare
+// equal.
+func remoteIdentity(remote string) string {
+	remote = strings.TrimSpace(remote)
+	if uri, err := url.Parse(remote); err == nil && strings.Contains(remote, "://") {
+		remote = uri.Hostname() + "/" + strings.TrimPrefix(uri.Path, "/")
+	} else if host, path, found := strings.Cut(remote, ":"); found {
+		// [user@]host:path
+		if _, withoutUser, hasUser := strings.Cut(host, "@"); hasUser {
+			host = withoutUser
+		}
+		remote = host + "/" + strings.TrimPrefix(path, "/")
+	}
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSuffix(remote, "/"), ".git"))
+}
+
+// unpin removes the pin of key, unless it was replaced by another push meanwhile.
+func unpin(key pinKey, pushed pin) {
+	pinnedCommitsMutex.Lock()
+	defer pinnedCommitsMutex.Unlock()
+	if pinnedCommits[key] == pushed {
+		delete(pinnedCommits, key)
+	}
+}
+
+func pinnedCommit(key pinKey) (pin, bool) {
+	pinnedCommitsMutex.Lock()
+	defer pinnedCommitsMutex.Unlock()
+	pushed, exists := pinnedCommits[key]
+	return pushed, exists
+}
+
+// pinnedRead tells which commit to read instead of commit, which ref resolved to, if ref is pinned. Pins are dropped
+// once the ref reached them, or once they're no longer reachable from the pushed ref, as that was rewritten or never
+// had the commit.
+func pinnedRead(ctx context.Context, key pinKey, commit string) string {
+	pushed, pinned := pinnedCommit(key)
+	if !pinned {
+		return commit
+	}
+	if _, err := runGit(ctx, key.repository, "merge-base", "--is-ancestor", pushed.commit, commit); err == nil {
+		// The ref caught up with the push or moved past it, a late or repeated webhook mustn't hold it back
+		unpin(key, pushed)
+		return commit
+	}
+	if _, err := runGit(ctx, key.repository, "cat-file", "-e", pushed.commit+"^{commit}"); err != nil {
+		return commit // A pushed commit the repository hasn't been updated with yet can't be read, ref is the best we have until then
+	}
+
+	patterns := []string{pushed.pushedRef}
+	if branch, isBranch := strings.CutPrefix(pushed.pushedRef, "refs/heads/"); isBranch {
+		patterns = append(patterns, "refs/remotes/*/"+branch)
+	}
+	containing, err := runGit(ctx, key.repository, append([]string{"for-each-ref", "--format=%(refname)", "--contains", pushed.commit}, patterns...)...)
+	if err != nil {
+		return commit
+	}
+	if len(bytes.TrimSpace(containing)) == 0 {
+		unpin(key, pushed)
+		return commit
+	}
+	return pushed.commit
+}
+
+// readGitBlocklist reads the blocklist at uri from its repository. If it resolves to the commit previous was read at,
+// errNotModified is returned.
+func readGitBlocklist(uri *url.URL, previous httpValidators) ([]byte, httpValidators, error) {
+	source, err := parseGitLocation(uri)
+	if err != nil {
+		return nil, httpValidators{}, err
+	}
+	options := HTTPDownloader.currentOptions()
+	ctx := context.Background()
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+
+	resolved, err := runGit(ctx, source.repository, "rev-parse", "--verify", "--end-of-options", source.ref+"^{commit}")
+	if err != nil {
+		return nil, httpValidators{}, fmt.Errorf("resolving %s in %s: %w", source.ref, source.repository, err)
+	}
+	commit := pinnedRead(ctx, pinKey{source.repository, source.ref}, string(bytes.TrimSpace(resolved)))
+	if commit == previous.Commit {
+		return nil, previous, errNotModified
+	}
+
+	blocklistBytes, err := runGit(ctx, source.repository, "cat-file", "blob", commit+":"+source.path)
+	if err != nil {
+		return nil, httpValidators{}, fmt.Errorf("reading %s at %s from %s: %w", source.path, commit, source.repository, err)
+	}
+	if options.MaxBodyBytes > 0 && int64(len(blocklistBytes)) > options.MaxBodyBytes {
+		return nil, httpValidators{}, fmt.Errorf("%s at %s is larger than %d bytes", source.path, commit, options.MaxBodyBytes)
+	}
+	return blocklistBytes, httpValidators{Commit: commit}, nil
+}
+
+// atCommit returns signatureLocation read at commit if it follows the same ref in the same repository as the git
+// source at location, so a blocklist is never checked against the signature of another commit.
+func atCommit(location, signatureLocation, commit string) string {
+	source, err := url.Parse(location)
+	if err != nil || commit == "" || source.Scheme != gitScheme {
+		return signatureLocation
+	}
+	signature, err := url.Parse(signatureLocation)
+	if err != nil || signature.Scheme != gitScheme || signature.Path != source.Path ||
+		signature.Query().Get("ref") != source.Query().Get("ref") {
+		return signatureLocation
+	}
+	query := signature.Query()
+	query.Set("ref", commit)
+	signature.RawQuery = query.Encode()
+	return signature.String()
+}
+
+// runGit runs git in repository and returns what it printed, errors carry what it complained about.
+func runGit(ctx context.Context, repository string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(ctx, "git", append([]string{"-C", repository}, args...)...)
+	command.Stdout, command.Stderr = &stdout, &stderr
+	if err := command.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%w: %s", err, message)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
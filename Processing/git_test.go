@@ -0,0 +1,206 @@
+package Processing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testGit runs git in repository, failing the test if it fails.
+func testGit(t *testing.T, repository string, args ...string) string {
+	output, err := exec.Command("git", append([]string{"-C", repository, "-c", "user.name=AdGoBye", "-c", "user.email=adgobye@example.com"}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %s: %s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// newBlocklistRepository creates a clone of remote with two commits of AGBTest.toml, tagging the first one v1. It
+// returns the repository and both commits.
+func newBlocklistRepository(t *testing.T, remote string) (repository string, first string, second string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	repository = t.TempDir()
+	commit := func(content string) string {
+		if err := os.WriteFile(filepath.Join(repository, "AGBTest.toml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		testGit(t, repository, "add", "AGBTest.toml")
+		testGit(t, repository, "commit", "-q", "-m", "Update AGBTest")
+		return testGit(t, repository, "rev-parse", "HEAD")
+	}
+
+	testGit(t, repository, "init", "-q", "-b", "main")
+	testGit(t, repository, "remote", "add", "origin", remote)
+	block := "[[block]]\nfriendly_name = \"Test\"\nworld_id = \"wrld_00000000-0000-0000-0000-000000000000\"\ngame_objects = [{ name = \"Poster\" }]\n"
+	first = commit("title = \"AGBTest\"\n" + block)
+	testGit(t, repository, "tag", "v1")
+	second = commit("title = \"AGBTest\"\n" + block + strings.ReplaceAll(block, "00000000-", "11111111-"))
+	return repository, first, second
+}
+
+func Test_readGitBlocklist(t *testing.T) {
+	repository, first, second := newBlocklistRepository(t, "https://github.com/AdGoBye/AGBTest.git")
+	base := "git+file://" + repository
+
+	tests := []struct {
+		name         string
+		location     string
+		wantRevision string
+		wantWorlds   int
+		wantErr      bool
+	}{
+		{"branch", base + "?ref=main&path=AGBTest.toml", second, 2, false},
+		{"tag", base + "?ref=v1&path=AGBTest.toml", first, 1, false},
+		{"commit", base + "?ref=" + first + "&path=AGBTest.toml", first, 1, false},
+		{"defaults to HEAD", base + "?path=AGBTest.toml", second, 2, false},
+		{"unknown ref", base + "?ref=nonexistent&path=AGBTest.toml", "", 0, true},
+		{"ref that looks like an option", base + "?ref=--output=/tmp/x&path=AGBTest.toml", "", 0, true},
+		{"missing file", base + "?ref=main&path=AGBUpsell.toml", "", 0, true},
+		{"no path", base + "?ref=main", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, results, _ := GenerateObjectIndex([]string{tt.location})
+			if (results[0].Error != "") != tt.wantErr {
+				t.Fatalf("GenerateObjectIndex() error = %v, wantErr %v", results[0].Error, tt.wantErr)
+			}
+			assert.Equal(t, tt.wantRevision, results[0].Revision)
+			assert.Equal(t, tt.wantWorlds, results[0].Worlds)
+		})
+	}
+}
+
+func TestPinPush(t *testing.T) {
+	repository, first, second := newBlocklistRepository(t, "git@github.com:AdGoBye/AGBTest.git")
+	other, _, otherSecond := newBlocklistRepository(t, "https://github.com/AdGoBye/AGBOther.git")
+	location := "git+file://" + repository + "?ref=main&path=AGBTest.toml"
+	otherLocation := "git+file://" + other + "?ref=main&path=AGBTest.toml"
+	locations := []string{location, otherLocation, "https://example.com/AGBTest.toml"}
+	const deleted = "0000000000000000000000000000000000000000"
+	push := func(commit string) int {
+		pinned, err := PinPush(locations, Push{Remotes: []string{"https://github.com/AdGoBye/AGBTest.git"}, Ref: "refs/heads/main", Commit: commit})
+		assert.NoError(t, err)
+		return pinned
+	}
+	defer push(deleted)
+	revisions := func() (revisions []string) {
+		_, results, _ := GenerateObjectIndex(locations[:2])
+		for _, result := range results {
+			assert.Empty(t, result.Error)
+			revisions = append(revisions, result.Revision)
+		}
+		return revisions
+	}
+
+	// The clone fetched the push, but its branch is behind
+	testGit(t, repository, "update-ref", "refs/heads/main", first)
+	testGit(t, repository, "update-ref", "refs/remotes/origin/main", second)
+	assert.Equal(t, 1, push(second), "only the clone of the pushed repository should be pinned")
+	assert.Equal(t, []string{second, otherSecond}, revisions())
+
+	testGit(t, repository, "update-ref", "refs/heads/main", second)
+	assert.Equal(t, []string{second, otherSecond}, revisions())
+	testGit(t, repository, "update-ref", "refs/heads/main", first)
+	assert.Equal(t, first, revisions()[0], "the pin should be gone once the branch caught up with it")
+
+	testGit(t, repository, "update-ref", "refs/heads/main", second)
+	push(first)
+	assert.Equal(t, second, revisions()[0], "a late webhook mustn't take the branch back")
+
+	testGit(t, repository, "update-ref", "refs/heads/main", first)
+	push(strings.Repeat("1", 40))
+	assert.Equal(t, first, revisions()[0], "commits the clone doesn't have yet should fall back to the branch")
+	push(second)
+	push(deleted)
+	assert.Equal(t, first, revisions()[0], "deleting the branch should remove the pin")
+
+	// A commit the clone has, but on no branch of the pushed name
+	unrelated := testGit(t, repository, "commit-tree", "-p", first, "-m", "Unrelated", second+"^{tree}")
+	push(unrelated)
+	assert.Equal(t, first, revisions()[0], "commits the pushed branch doesn't contain shouldn't be read")
+	testGit(t, repository, "update-ref", "refs/remotes/origin/main", unrelated)
+	assert.Equal(t, first, revisions()[0], "the pin should have been dropped for good")
+
+	// The branch is force-pushed over the pinned commit
+	testGit(t, repository, "update-ref", "refs/remotes/origin/main", second)
+	push(second)
+	assert.Equal(t, second, revisions()[0])
+	testGit(t, repository, "update-ref", "refs/remotes/origin/main", unrelated)
+	assert.Equal(t, first, revisions()[0], "a rewritten branch should drop the pin")
+	testGit(t, repository, "update-ref", "refs/remotes/origin/main", second)
+	assert.Equal(t, first, revisions()[0], "a dropped pin shouldn't come back")
+
+	pinned, err := PinPush(locations, Push{Remotes: []string{"https://github.com/AdGoBye/AGBTest"}, Ref: "refs/heads/other", Commit: second})
+	assert.NoError(t, err)
+	assert.Zero(t, pinned, "sources following another branch shouldn't be pinned")
+	_, err = PinPush(locations, Push{Ref: "refs/heads/main", Commit: "--upload-pack=touch"})
+	assert.Error(t, err)
+}
+
+func Test_remoteIdentity(t *testing.T) {
+	want := "github.com/adgobye/agbtest"
+	for _, remote := range []string{
+		"https://github.com/AdGoBye/AGBTest.git",
+		"https://github.com/AdGoBye/AGBTest/",
+		"git@github.com:AdGoBye/AGBTest.git",
+		"ssh://git@github.com/AdGoBye/AGBTest.git",
+		"git://github.com/AdGoBye/AGBTest.git",
+	} {
+		assert.Equal(t, want, remoteIdentity(remote), remote)
+	}
+	assert.NotEqual(t, want, remoteIdentity("https://github.com/AdGoBye/AGBOther.git"))
+}
+
+func Test_readGitBlocklistVerifiesSignatureAtSameCommit(t *testing.T) {
+	repository, _, _ := newBlocklistRepository(t, "https://github.com/AdGoBye/AGBTest.git")
+	location := "git+file://" + repository + "?ref=main&path=AGBTest.toml"
+	key := newMinisignKey(t, "AGBSign1")
+	sign := func() string {
+		content, err := os.ReadFile(filepath.Join(repository, "AGBTest.toml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(filepath.Join(repository, "AGBTest.toml.minisig"), key.sign(content, false, "timestamp:1718000000"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		testGit(t, repository, "add", "AGBTest.toml.minisig")
+		testGit(t, repository, "commit", "-q", "-m", "Sign AGBTest")
+		return testGit(t, repository, "rev-parse", "HEAD")
+	}
+	signed := sign()
+	Cache.SetDirectory(t.TempDir())
+	defer Cache.SetDirectory("")
+	SetSourceOptions(map[string]SourceOptions{location: {PublicKeys: []string{key.public}}})
+	defer SetSourceOptions(nil)
+
+	blocklistBytes, validators, err := fetchBlocklistBytes(location, httpValidators{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The branch moves on to a list the old signature doesn't cover before the signature is read
+	if err = os.WriteFile(filepath.Join(repository, "AGBTest.toml"), []byte("title = \"AGBTest\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testGit(t, repository, "commit", "-q", "-a", "-m", "Empty AGBTest")
+	sign()
+	_, err = verifySource(location, sourceOptionsFor(location), blocklistBytes, validators.Commit)
+	assert.NoError(t, err, "the signature should be read at the commit the list was")
+
+	_, result, _ := loadSource(location)
+	assert.Empty(t, result.Error)
+	if err = os.Rename(repository, repository+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Rename(repository+".moved", repository)
+	_, result, _ = loadSource(location)
+	assert.True(t, result.FromCache)
+	assert.NotEqual(t, signed, result.Revision)
+	assert.Regexp(t, commitPattern, result.Revision, "cached git sources should keep the commit as revision")
+}
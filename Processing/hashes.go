@@ -0,0 +1,59 @@
+package Processing
+
+// HashedWorld is a world of a blocklist together with the hashes clients report it and its objects by.
+type HashedWorld struct {
+	WorldId      string
+	FriendlyName string
+	Hash         string
+	Objects      []HashedObject
+}
+
+// HashedObject is an object of a blocklist together with the hash clients report it by.
+type HashedObject struct {
+	Hash     string
+	Name     string
+	Position *GameobjectPosition
+	Parent   *Gameobject
+}
+
+// HashBlocklist hashes every world and object of blocklist the way the index does, in the order they are listed.
+func HashBlocklist(blocklist Blocklist) []HashedWorld {
+	worlds := make([]HashedWorld, 0, len(blocklist.Blocks))
+	for _, block := range blocklist.Blocks {
+		world := HashedWorld{
+			WorldId:      block.WorldId,
+			FriendlyName: block.FriendlyName,
+			Hash:         HashWorldId(block.WorldId),
+			Objects:      make([]HashedObject, 0, len(block.GameObjects)),
+		}
+		for _, object := range block.GameObjects {
+			world.Objects = append(world.Objects, HashedObject{
+				Hash:     HashGameobject(object),
+				Name:     object.Name,
+				Position: object.Position,
+				Parent:   object.Parent,
+			})
+		}
+		worlds = append(worlds, world)
+	}
+	return worlds
+}
+
+// LookupHash returns the worlds whose hash or the hash of one of their objects is hash. Matching worlds are returned
+// with all their objects, worlds matched through an object only with that object.
+func LookupHash(worlds []HashedWorld, hash string) (matches []HashedWorld) {
+	for _, world := range worlds {
+		if world.Hash == hash {
+			matches = append(matches, world)
+			continue
+		}
+		for _, object := range world.Objects {
+			if object.Hash == hash {
+				match := world
+				match.Objects = []HashedObject{object}
+				matches = append(matches, match)
+			}
+		}
+	}
+	return matches
+}
@@ -0,0 +1,54 @@
+package Processing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHashBlocklist(t *testing.T) {
+	poster := Gameobject{Name: "Poster", Position: &GameobjectPosition{X: 1, Y: 2, Z: 3}}
+	frame := Gameobject{Name: "Frame", Parent: &Gameobject{Name: "Wall"}}
+	blocklist := Blocklist{Title: "AGBTest", Blocks: []Block{
+		{FriendlyName: "Test", WorldId: "wrld_00000000-0000-0000-0000-000000000000", GameObjects: []Gameobject{poster, frame}},
+		{FriendlyName: "Other", WorldId: "wrld_11111111-1111-1111-1111-111111111111", GameObjects: []Gameobject{poster}},
+	}}
+
+	worlds := HashBlocklist(blocklist)
+
+	// The hashes have to be the ones the index is keyed by, otherwise they're useless for looking up misses
+	mapping := make(map[string]WorldObject)
+	indexBlocklist(mapping, blocklist, SourceResult{})
+	assert.Len(t, worlds, 2)
+	for _, world := range worlds {
+		indexed, exists := mapping[world.Hash]
+		assert.True(t, exists, "world %s isn't indexed as %s", world.WorldId, world.Hash)
+		for _, object := range world.Objects {
+			assert.Contains(t, indexed.GameObjectMapping, object.Hash)
+		}
+	}
+	assert.Equal(t, HashedObject{Hash: HashGameobject(frame), Name: "Frame", Parent: frame.Parent}, worlds[0].Objects[1])
+
+	tests := []struct {
+		name   string
+		hash   string
+		want   []string
+		counts []int
+	}{
+		{"world returns all its objects", worlds[1].Hash, []string{"Other"}, []int{1}},
+		{"object in several worlds", HashGameobject(poster), []string{"Test", "Other"}, []int{1, 1}},
+		{"object in one world", HashGameobject(frame), []string{"Test"}, []int{1}},
+		{"unknown hash", "bogus", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			var counts []int
+			for _, match := range LookupHash(worlds, tt.hash) {
+				names = append(names, match.FriendlyName)
+				counts = append(counts, len(match.Objects))
+			}
+			assert.Equal(t, tt.want, names)
+			assert.Equal(t, tt.counts, counts)
+		})
+	}
+}
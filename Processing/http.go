@@ -0,0 +1,214 @@
+package Processing
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DownloadOptions controls how blocklists are fetched over HTTP.
+type DownloadOptions struct {
+	Timeout      time.Duration
+	Retries      int
+	RetryBackoff time.Duration
+	MaxBodyBytes int64
+}
+
+// httpValidators are what we need to ask a server whether a blocklist changed since we last fetched it. They come
+// with the Content-Type it was served as, which a server confirming our copy is still current doesn't repeat.
+type httpValidators struct {
+	ETag         string
+	LastModified string
+	ContentType  string
+	// Commit is what git sources were read at, see readGitBlocklist.
+	Commit string
+}
+
+// Downloader fetches blocklists over HTTP.
+type Downloader struct {
+	mutex   sync.RWMutex
+	options DownloadOptions
+	client  *http.Client
+}
+
+var (
+	HTTPDownloader = NewDownloader(DownloadOptions{
+		Timeout:      30 * time.Second,
+		Retries:      0,
+		RetryBackoff: time.Second,
+		MaxBodyBytes: 16 << 20,
+	})
+
+	// errNotModified is returned if the server confirmed our copy is still current.
+	errNotModified = errors.New("blocklist not modified")
+	// errBodyTooLarge and errUnsupportedEncoding will be the same however often we ask.
+	errBodyTooLarge        = errors.New("body exceeds limit")
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+)
+
+func NewDownloader(options DownloadOptions) *Downloader {
+	downloader := &Downloader{}
+	downloader.Configure(options)
+	return downloader
+}
+
+// Configure replaces the options, downloads already in flight finish with the old ones. Idle connections kept for
+// the old options are closed.
+func (downloader *Downloader) Configure(options DownloadOptions) {
+	downloader.mutex.Lock()
+	defer downloader.mutex.Unlock()
+	if downloader.client != nil {
+		downloader.client.CloseIdleConnections()
+	}
+	downloader.options = options
+	downloader.client = &http.Client{
+		Timeout: options.Timeout,
+		// We negotiate and decode Content-Encoding ourselves, the transport only knows gzip
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, DisableCompression: true},
+	}
+}
+
+func (downloader *Downloader) currentOptions() DownloadOptions {
+	downloader.mutex.RLock()
+	defer downloader.mutex.RUnlock()
+	return downloader.options
+}
+
+// httpStatusError is returned for responses we can't do anything with.
+type httpStatusError struct {
+	Location   string
+	Status     string
+	StatusCode int
+}
+
+func (err httpStatusError) Error() string {
+	return fmt.Sprintf("fetching %s returned %s", err.Location, err.Status)
+}
+
+// retryable tells whether asking again might get us a different answer.
+func (err httpStatusError) retryable() bool {
+	return err.StatusCode >= 500 || err.StatusCode == http.StatusTooManyRequests || err.StatusCode == http.StatusRequestTimeout
+}
+
+// retryable tells whether err might go away by downloading again.
+func retryable(err error) bool {
+	var statusErr httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.retryable()
+	}
+	return !errors.Is(err, errBodyTooLarge) && !errors.Is(err, errUnsupportedEncoding)
+}
+
+// Download fetches location, sending previous as conditional request. If the server says nothing changed,
+// errNotModified is returned.
+func (downloader *Downloader) Download(location string, previous httpValidators) ([]byte, httpValidators, error) {
+	downloader.mutex.RLock()
+	options, client := downloader.options, downloader.client
+	downloader.mutex.RUnlock()
+
+	var err error
+	for attempt := 0; attempt <= options.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(options.RetryBackoff << (attempt - 1))
+		}
+
+		var body []byte
+		var validators httpValidators
+		body, validators, err = downloadOnce(client, options.MaxBodyBytes, location, previous)
+		if err == nil || errors.Is(err, errNotModified) {
+			return body, validators, err
+		}
+		if !retryable(err) {
+			break
+		}
+	}
+	return nil, httpValidators{}, err
+}
+
+func downloadOnce(client *http.Client, maxBodyBytes int64, location string, previous httpValidators) ([]byte, httpValidators, error) {
+	request, err := http.NewRequest(http.MethodGet, location, nil)
+	if err != nil {
+		return nil, httpValidators{}, err
+	}
+	request.Header.Set("User-Agent", "AGB-BlocklistSrv")
+	request.Header.Set("Accept-Encoding", "gzip, zstd")
+	if previous.ETag != "" {
+		request.Header.Set("If-None-Match", previous.ETag)
+	}
+	if previous.LastModified != "" {
+		request.Header.Set("If-Modified-Since", previous.LastModified)
+	}
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, httpValidators{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, previous, errNotModified
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, httpValidators{}, httpStatusError{Location: location, Status: resp.Status, StatusCode: resp.StatusCode}
+	}
+
+	body, err := decodeBody(resp, maxBodyBytes)
+	if err != nil {
+		return nil, httpValidators{}, fmt.Errorf("reading %s: %w", location, err)
+	}
+	return body, httpValidators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		ContentType:  resp.Header.Get("Content-Type"),
+	}, nil
+}
+
+// decodeBody reads the response body, undoing Content-Encoding and refusing anything larger than maxBodyBytes.
+func decodeBody(resp *http.Response, maxBodyBytes int64) ([]byte, error) {
+	var reader io.Reader = resp.Body
+	switch encoding := resp.Header.Get("Content-Encoding"); encoding {
+	case "", "identity":
+	case "gzip":
+		gzipReader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case "zstd":
+		// Frames declare how much history they need, which is allocated upfront whatever the limit on the output
+		options := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+		if maxBodyBytes > 0 {
+			options = append(options, zstd.WithDecoderMaxWindow(max(uint64(maxBodyBytes), zstd.MinWindowSize)))
+		}
+		zstdReader, err := zstd.NewReader(resp.Body, options...)
+		if err != nil {
+			return nil, err
+		}
+		defer zstdReader.Close()
+		reader = zstdReader
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedEncoding, encoding)
+	}
+
+	if maxBodyBytes <= 0 {
+		return io.ReadAll(reader)
+	}
+	// Read one byte past the limit to tell a body of exactly maxBodyBytes apart from a larger one
+	body, err := io.ReadAll(io.LimitReader(reader, maxBodyBytes+1))
+	if errors.Is(err, zstd.ErrWindowSizeExceeded) || errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		return nil, fmt.Errorf("%w of %d bytes: %w", errBodyTooLarge, maxBodyBytes, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBodyBytes {
+		return nil, fmt.Errorf("%w of %d bytes", errBodyTooLarge, maxBodyBytes)
+	}
+	return body, nil
+}
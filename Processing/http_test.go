@@ -0,0 +1,122 @@
+package Processing
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDownloader_Download(t *testing.T) {
+	const blocklist = "title = \"AGBTest\"\n"
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	gzipWriter.Write([]byte(blocklist))
+	gzipWriter.Close()
+
+	zstdEncoder, _ := zstd.NewWriter(nil)
+	zstdEncoded := zstdEncoder.EncodeAll([]byte(blocklist), nil)
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/plain.toml":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Type", "application/toml")
+			w.Write([]byte(blocklist))
+		case "/gzip.toml":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gzipped.Bytes())
+		case "/zstd.toml":
+			w.Header().Set("Content-Encoding", "zstd")
+			w.Write(zstdEncoded)
+		case "/flaky.toml":
+			attempts++
+			if attempts < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte(blocklist))
+		case "/huge.toml":
+			w.Write(bytes.Repeat([]byte("#"), 64))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	downloader := NewDownloader(DownloadOptions{Timeout: time.Second, Retries: 2, RetryBackoff: time.Millisecond, MaxBodyBytes: 32})
+	tests := []struct {
+		name           string
+		path           string
+		previous       httpValidators
+		want           []byte
+		wantValidators httpValidators
+		wantErr        error
+		wantAnyErr     bool
+	}{
+		{name: "plain", path: "/plain.toml", want: []byte(blocklist), wantValidators: httpValidators{ETag: `"v1"`, ContentType: "application/toml"}},
+		{name: "not modified", path: "/plain.toml", previous: httpValidators{ETag: `"v1"`}, wantValidators: httpValidators{ETag: `"v1"`}, wantErr: errNotModified},
+		{name: "gzip encoded", path: "/gzip.toml", want: []byte(blocklist)},
+		{name: "zstd encoded", path: "/zstd.toml", want: []byte(blocklist)},
+		{name: "retried after server error", path: "/flaky.toml", want: []byte(blocklist), wantValidators: httpValidators{ContentType: "text/plain; charset=utf-8"}},
+		{name: "not found", path: "/missing.toml", wantAnyErr: true},
+		{name: "body over limit", path: "/huge.toml", wantAnyErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotValidators, err := downloader.Download(server.URL+tt.path, tt.previous)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else if (err != nil) != tt.wantAnyErr {
+				t.Errorf("Download() error = %v, wantErr %v", err, tt.wantAnyErr)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantValidators, gotValidators)
+		})
+	}
+}
+
+func TestDownloader_DownloadRetriesOnlyWhatMightSucceed(t *testing.T) {
+	// A frame holding a single byte that asks for an 8 MiB window, far more than any body we accept. Encoders shrink
+	// the window to fit the content, so it's written by hand.
+	largeWindow := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 13 << 3, 0x09, 0x00, 0x00, '#'}
+
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		switch r.URL.Path {
+		case "/huge.toml":
+			w.Write(bytes.Repeat([]byte("#"), 64))
+		case "/window.toml":
+			w.Header().Set("Content-Encoding", "zstd")
+			w.Write(largeWindow)
+		case "/brotli.toml":
+			w.Header().Set("Content-Encoding", "br")
+			w.Write([]byte("#"))
+		case "/forbidden.toml":
+			w.WriteHeader(http.StatusForbidden)
+		case "/timeout.toml":
+			w.WriteHeader(http.StatusRequestTimeout)
+		case "/limited.toml":
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	downloader := NewDownloader(DownloadOptions{Timeout: time.Second, Retries: 2, RetryBackoff: time.Millisecond, MaxBodyBytes: 32})
+	for _, path := range []string{"/huge.toml", "/window.toml", "/brotli.toml", "/forbidden.toml", "/timeout.toml", "/limited.toml"} {
+		_, _, err := downloader.Download(server.URL+path, httpValidators{})
+		assert.Error(t, err, path)
+	}
+	assert.Equal(t, map[string]int{"/huge.toml": 1, "/window.toml": 1, "/brotli.toml": 1, "/forbidden.toml": 1, "/timeout.toml": 3, "/limited.toml": 3}, requests)
+}
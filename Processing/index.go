@@ -0,0 +1,101 @@
+package Processing
+
+import (
+	"AGB-BlocklistSrv/Metrics"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WorldObjectIndex is one generation of the index. Once published through an IndexStore it must not be modified,
+// readers hold on to it without any locking.
+type WorldObjectIndex struct {
+	Generation uint64
+	BuiltAt    time.Time
+	Sources    []string
+	Results    []SourceResult
+	// Blocklists describes every blocklist indexed in this generation, objects point to theirs as ParentBlocklist.
+	Blocklists []*BlocklistInfo
+	Index      map[string]WorldObject
+}
+
+// IndexStore publishes WorldObjectIndex generations atomically, so readers always see one complete generation.
+type IndexStore struct {
+	current    atomic.Pointer[WorldObjectIndex]
+	publishing sync.Mutex
+	generation uint64
+}
+
+var (
+	Index = &IndexStore{}
+)
+
+// Snapshot returns the current generation. Before anything was published, this is an empty generation 0.
+func (store *IndexStore) Snapshot() *WorldObjectIndex {
+	if snapshot := store.current.Load(); snapshot != nil {
+		return snapshot
+	}
+	return &WorldObjectIndex{Index: map[string]WorldObject{}}
+}
+
+// Publish makes mapping the current generation. The store takes ownership of mapping, it must not be modified after.
+func (store *IndexStore) Publish(sources []string, mapping map[string]WorldObject) *WorldObjectIndex {
+	store.publishing.Lock()
+	defer store.publishing.Unlock()
+	return store.publish(sources, nil, nil, mapping)
+}
+
+// Rebuild fetches the blocklists at sources and publishes the result as new generation. Sources that failed are
+// recorded in Results of the new generation.
+// Concurrent rebuilds are serialized, so generations are published in the order they were built.
+func (store *IndexStore) Rebuild(sources []string) *WorldObjectIndex {
+	store.publishing.Lock()
+	defer store.publishing.Unlock()
+	buildStarted := time.Now()
+	mapping, results, blocklists := GenerateObjectIndex(sources)
+	Metrics.IndexBuildDuration.Observe(time.Since(buildStarted).Seconds())
+	return store.publish(sources, results, blocklists, mapping)
+}
+
+// Refresh is Rebuild, except only the sources listed in refetch are fetched again. Every other source is indexed
+// from the copy it parsed to last time, so a single fixed blocklist can be picked up without touching the rest.
+// Sources without such a copy are left out rather than fetched.
+func (store *IndexStore) Refresh(sources []string, refetch []string) *WorldObjectIndex {
+	store.publishing.Lock()
+	defer store.publishing.Unlock()
+	buildStarted := time.Now()
+	mapping, results, blocklists := generateObjectIndex(sources, func(location string) bool {
+		return slices.Contains(refetch, location)
+	})
+	Metrics.IndexBuildDuration.Observe(time.Since(buildStarted).Seconds())
+	return store.publish(sources, results, blocklists, mapping)
+}
+
+func (store *IndexStore) publish(sources []string, results []SourceResult, blocklists []*BlocklistInfo, mapping map[string]WorldObject) *WorldObjectIndex {
+	store.generation++
+	snapshot := &WorldObjectIndex{
+		Generation: store.generation,
+		BuiltAt:    time.Now(),
+		Sources:    slices.Clone(sources),
+		Results:    results,
+		Blocklists: blocklists,
+		Index:      mapping,
+	}
+	store.current.Store(snapshot)
+
+	objects := 0
+	for _, world := range mapping {
+		objects += len(world.GameObjectMapping)
+	}
+	Metrics.IndexGeneration.Set(float64(snapshot.Generation))
+	Metrics.IndexLastBuild.Set(float64(snapshot.BuiltAt.Unix()))
+	Metrics.IndexWorlds.Set(float64(len(mapping)))
+	Metrics.IndexObjects.Set(float64(objects))
+	return snapshot
+}
+
+// HandleBlocklistCallback handles object against the current generation.
+func (store *IndexStore) HandleBlocklistCallback(object IncomingCallback) {
+	store.Snapshot().HandleBlocklistCallback(object)
+}
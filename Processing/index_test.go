@@ -0,0 +1,133 @@
+package Processing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// writeBlocklist writes a blocklist with a single world named like the blocklist holding object to directory, and
+// returns its location.
+func writeBlocklist(t *testing.T, directory, name, object string) string {
+	content := "title = \"" + name + "\"\n[[block]]\nfriendly_name = \"" + name + "\"\n" +
+		"world_id = \"wrld_" + name + "\"\ngame_objects = [{ name = \"" + object + "\" }]\n"
+	if err := os.WriteFile(filepath.Join(directory, name+".toml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return "file://" + filepath.Join(directory, name+".toml")
+}
+
+func TestIndexStore_Publish(t *testing.T) {
+	store := &IndexStore{}
+	assert.Equal(t, uint64(0), store.Snapshot().Generation, "empty store should serve generation 0")
+	assert.Nil(t, store.Snapshot().GetWorldById("anything"))
+
+	sources := []string{"file:///AGBBase.toml"}
+	first := store.Publish(sources, map[string]WorldObject{"first": {FriendlyName: "First"}})
+	sources[0] = "file:///mutated.toml"
+	second := store.Publish(sources, map[string]WorldObject{"second": {FriendlyName: "Second"}})
+
+	assert.Equal(t, uint64(1), first.Generation)
+	assert.Equal(t, uint64(2), second.Generation)
+	assert.Equal(t, []string{"file:///AGBBase.toml"}, first.Sources, "published sources must not alias the caller's slice")
+	assert.Same(t, second, store.Snapshot())
+	assert.NotNil(t, first.GetWorldById("first"), "earlier generations stay intact for readers holding them")
+	assert.Nil(t, store.Snapshot().GetWorldById("first"))
+}
+
+func TestIndexStore_Refresh(t *testing.T) {
+	directory := t.TempDir()
+	fixed, untouched := writeBlocklist(t, directory, "Fixed", "Broken"), writeBlocklist(t, directory, "Untouched", "Original")
+	sources := []string{fixed, untouched}
+
+	store := &IndexStore{}
+	first := store.Rebuild(sources)
+	firstRevision := first.Results[1].Revision
+	writeBlocklist(t, directory, "Fixed", "Repaired")
+	writeBlocklist(t, directory, "Untouched", "Changed")
+	snapshot := store.Refresh(sources, []string{fixed})
+
+	objectNames := func(worldId string) (names []string) {
+		objects, _ := snapshot.Objects(HashWorldId(worldId))
+		for _, object := range objects {
+			names = append(names, object.Name)
+		}
+		return names
+	}
+	assert.Equal(t, uint64(2), snapshot.Generation)
+	assert.Equal(t, []string{"Repaired"}, objectNames("wrld_Fixed"), "selected source should be fetched again")
+	assert.Equal(t, []string{"Original"}, objectNames("wrld_Untouched"), "other sources should keep their parsed copy")
+	if assert.Len(t, snapshot.Results, 2) {
+		assert.Positive(t, snapshot.Results[0].Bytes)
+		assert.Equal(t, SourceResult{Location: untouched, Reused: true, Worlds: 1, Objects: 1, Revision: firstRevision}, snapshot.Results[1])
+	}
+	if assert.Len(t, snapshot.Blocklists, 2) {
+		assert.NotEqual(t, first.Blocklists[0].Revision, snapshot.Blocklists[0].Revision, "refetched source should have a new revision")
+		assert.Equal(t, untouched, snapshot.Blocklists[1].Source)
+		assert.Same(t, snapshot.Blocklists[1], snapshot.Index[HashWorldId("wrld_Untouched")].GameObjectMapping[HashGameobject(Gameobject{Name: "Original"})].ParentBlocklist)
+	}
+}
+
+func TestIndexStore_RefreshLeavesBrokenSourcesAlone(t *testing.T) {
+	Cache.SetDirectory(t.TempDir())
+	defer Cache.SetDirectory("")
+
+	directory := t.TempDir()
+	healthy, cached := writeBlocklist(t, directory, "Healthy", "Poster"), writeBlocklist(t, directory, "Cached", "Poster")
+	broken := "file://" + filepath.Join(directory, "Broken.toml")
+	sources := []string{healthy, cached, broken}
+
+	store := &IndexStore{}
+	store.Rebuild(sources)
+	if err := os.Remove(filepath.Join(directory, "Cached.toml")); err != nil {
+		t.Fatal(err)
+	}
+	store.Rebuild(sources)
+	var snapshot *WorldObjectIndex
+	for range 3 {
+		snapshot = store.Refresh(sources, []string{healthy})
+	}
+
+	statuses := SourceStatuses(sources)
+	assert.Equal(t, 1, statuses[1].ConsecutiveFailures, "cached source should only be fetched on rebuilds")
+	assert.Equal(t, 2, statuses[2].ConsecutiveFailures, "broken source should only be fetched on rebuilds")
+	assert.True(t, snapshot.Results[1].Reused)
+	assert.True(t, snapshot.Results[1].FromCache, "cached copy should stand in without fetching again")
+	assert.NotNil(t, snapshot.GetWorldById(HashWorldId("wrld_Cached")))
+	assert.True(t, snapshot.Results[2].Reused)
+	assert.NotEmpty(t, snapshot.Results[2].Error)
+	assert.Len(t, snapshot.Index, 2)
+}
+
+func TestIndexStore_RefreshOnlyFetchesSelectedSources(t *testing.T) {
+	var mutex sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.URL.Path]++
+		mutex.Unlock()
+		if r.URL.Path == "/broken.toml" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("title = \"" + r.URL.Path + "\"\n[[block]]\nfriendly_name = \"Test\"\n" +
+			"world_id = \"wrld_" + r.URL.Path + "\"\ngame_objects = [{ name = \"Poster\" }]\n"))
+	}))
+	defer server.Close()
+	selected, healthy, broken := server.URL+"/selected.toml", server.URL+"/healthy.toml", server.URL+"/broken.toml"
+	sources := []string{selected, healthy, broken}
+
+	store := &IndexStore{}
+	store.Rebuild(sources)
+	store.Refresh(sources, []string{selected})
+	store.Refresh(sources, []string{selected})
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, map[string]int{"/selected.toml": 3, "/healthy.toml": 1, "/broken.toml": 1}, requests,
+		"only the selected source should be fetched again")
+}
@@ -0,0 +1,116 @@
+package Processing
+
+import (
+	"AGB-BlocklistSrv/Metrics"
+	"fmt"
+	"github.com/gofiber/fiber/v2/log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IncomingCallback is a callback of any version together with what we know about how it arrived.
+// Fields a callback version doesn't carry are left empty.
+type IncomingCallback struct {
+	CallbackContainer
+	ClientVersion      string
+	BlocklistRevisions map[string]string
+	ReportedAt         time.Time
+	InstallId          string
+	ReceivedAt         time.Time
+	// Reporter identifies who sent the callback without revealing it, see ReporterFromAddress. Empty if unknown.
+	Reporter string
+}
+
+// IngestStats describes how far behind the ingest queue is.
+type IngestStats struct {
+	Queued   int
+	Capacity int
+	Workers  int
+	Accepted uint64
+	// Rejected counts callbacks turned away because the queue was full.
+	Rejected uint64
+}
+
+// IngestQueue sits between the HTTP handler and the index, so clients don't wait on receivers.
+// It's bounded, once full Submit refuses callbacks and it's up to the handler to tell the client to back off.
+type IngestQueue struct {
+	queue    chan IncomingCallback
+	handle   func(IncomingCallback)
+	workers  sync.WaitGroup
+	closing  sync.RWMutex
+	closed   bool
+	accepted atomic.Uint64
+	rejected atomic.Uint64
+	size     int
+}
+
+// NewIngestQueue starts workers that each pass queued callbacks to handle.
+func NewIngestQueue(workers, queueSize int, handle func(IncomingCallback)) *IngestQueue {
+	ingest := &IngestQueue{queue: make(chan IncomingCallback, queueSize), handle: handle, size: workers}
+	for range workers {
+		ingest.workers.Add(1)
+		go func() {
+			defer ingest.workers.Done()
+			ingest.work()
+		}()
+	}
+	return ingest
+}
+
+// Submit queues callback without blocking, it returns false if the queue is full or closed.
+func (ingest *IngestQueue) Submit(callback IncomingCallback) bool {
+	ingest.closing.RLock()
+	defer ingest.closing.RUnlock()
+	if ingest.closed {
+		ingest.rejected.Add(1)
+		Metrics.IngestRejected.Inc()
+		return false
+	}
+	select {
+	case ingest.queue <- callback:
+		ingest.accepted.Add(1)
+		return true
+	default:
+		ingest.rejected.Add(1)
+		Metrics.IngestRejected.Inc()
+		return false
+	}
+}
+
+func (ingest *IngestQueue) Stats() IngestStats {
+	return IngestStats{
+		Queued:   len(ingest.queue),
+		Capacity: cap(ingest.queue),
+		Workers:  ingest.size,
+		Accepted: ingest.accepted.Load(),
+		Rejected: ingest.rejected.Load(),
+	}
+}
+
+// Close stops accepting callbacks and waits until the queue is worked through.
+func (ingest *IngestQueue) Close() {
+	ingest.closing.Lock()
+	if !ingest.closed {
+		ingest.closed = true
+		close(ingest.queue)
+	}
+	ingest.closing.Unlock()
+	ingest.workers.Wait()
+}
+
+func (ingest *IngestQueue) work() {
+	for callback := range ingest.queue {
+		ingest.process(callback)
+	}
+}
+
+// process keeps a panic over a single callback from taking a worker with it.
+func (ingest *IngestQueue) process(callback IncomingCallback) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Errorf("Panicked while handling callback for %s: %s", callback.WorldId, fmt.Sprint(recovered))
+		}
+	}()
+	ingest.handle(callback)
+}
@@ -0,0 +1,34 @@
+package Processing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIngestQueue_RejectsWhenFull(t *testing.T) {
+	started, release := make(chan struct{}, 8), make(chan struct{})
+	handled := make(chan string, 8)
+	ingest := NewIngestQueue(1, 2, func(callback IncomingCallback) {
+		started <- struct{}{}
+		<-release
+		handled <- callback.WorldId
+	})
+
+	// One callback is held by the worker, two fit the queue, the rest has to be turned away
+	assert.True(t, ingest.Submit(IncomingCallback{CallbackContainer: CallbackContainer{WorldId: "held"}}))
+	<-started
+	assert.True(t, ingest.Submit(IncomingCallback{CallbackContainer: CallbackContainer{WorldId: "first"}}))
+	assert.True(t, ingest.Submit(IncomingCallback{CallbackContainer: CallbackContainer{WorldId: "second"}}))
+	assert.False(t, ingest.Submit(IncomingCallback{CallbackContainer: CallbackContainer{WorldId: "rejected"}}))
+
+	close(release)
+	ingest.Close()
+	close(handled)
+	var worlds []string
+	for world := range handled {
+		worlds = append(worlds, world)
+	}
+	assert.Equal(t, []string{"held", "first", "second"}, worlds, "queued callbacks should be drained on Close")
+	assert.Equal(t, IngestStats{Capacity: 2, Workers: 1, Accepted: 3, Rejected: 1}, ingest.Stats())
+	assert.False(t, ingest.Submit(IncomingCallback{}), "closed queue should refuse callbacks")
+}
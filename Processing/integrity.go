@@ -0,0 +1,191 @@
+package Processing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/blake2b"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// errVerificationFailed is wrapped by every error about a blocklist not being what it is supposed to be.
+var errVerificationFailed = errors.New("blocklist failed verification")
+
+// publicKey is a key blocklists can be signed with, either a minisign key or a bare Ed25519 key.
+type publicKey struct {
+	// id is the minisign key ID, nil for bare keys
+	id  []byte
+	key ed25519.PublicKey
+}
+
+// ValidatePublicKey checks that encoded is a public key blocklists can be verified with, see parsePublicKey.
+func ValidatePublicKey(encoded string) error {
+	_, err := parsePublicKey(encoded)
+	return err
+}
+
+// parsePublicKey parses a minisign public key, either the base64 line or a whole minisign.pub, or a base64 encoded
+// bare Ed25519 public key.
+func parsePublicKey(encoded string) (publicKey, error) {
+	decoded, err := base64.StdEncoding.DecodeString(lastLine(encoded))
+	if err != nil {
+		return publicKey{}, fmt.Errorf("public key isn't base64: %w", err)
+	}
+	switch {
+	case len(decoded) == ed25519.PublicKeySize:
+		return publicKey{key: decoded}, nil
+	case len(decoded) == 2+8+ed25519.PublicKeySize && string(decoded[:2]) == "Ed":
+		return publicKey{id: decoded[2:10], key: decoded[10:]}, nil
+	default:
+		return publicKey{}, errors.New("public key is neither a minisign nor an Ed25519 key")
+	}
+}
+
+// verifySource checks blocklistBytes fetched from location against the digest and keys in options, fetching the
+// signature if there are keys. commit is what git sources were read at, their signature is read at the same commit.
+// The signature is returned so the copy can be checked again without fetching it.
+func verifySource(location string, options SourceOptions, blocklistBytes []byte, commit string) ([]byte, error) {
+	if err := verifyDigest(options, blocklistBytes); err != nil || len(options.PublicKeys) == 0 {
+		return nil, err
+	}
+	signatureLocation := options.SignatureLocation
+	if signatureLocation == "" {
+		signatureLocation = defaultSignatureLocation(location)
+	}
+	signatureLocation = atCommit(location, signatureLocation, commit)
+	signature, _, err := fetchBlocklistBytes(signatureLocation, httpValidators{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: fetching signature %s: %w", errVerificationFailed, signatureLocation, err)
+	}
+	if err = verifySignedBy(options, blocklistBytes, signature); err != nil {
+		return nil, fmt.Errorf("%w: signature %s: %w", errVerificationFailed, signatureLocation, err)
+	}
+	return signature, nil
+}
+
+// verifyCopy checks a copy verified earlier against the digest and keys in options, which may have changed since.
+// signature is what verifySource returned for it.
+func verifyCopy(options SourceOptions, blocklistBytes []byte, signature []byte) error {
+	if err := verifyDigest(options, blocklistBytes); err != nil || len(options.PublicKeys) == 0 {
+		return err
+	}
+	if len(signature) == 0 {
+		return fmt.Errorf("%w: copy was kept without a signature", errVerificationFailed)
+	}
+	if err := verifySignedBy(options, blocklistBytes, signature); err != nil {
+		return fmt.Errorf("%w: signature of copy: %w", errVerificationFailed, err)
+	}
+	return nil
+}
+
+func verifyDigest(options SourceOptions, blocklistBytes []byte) error {
+	if options.SHA256 == "" {
+		return nil
+	}
+	digest := sha256.Sum256(blocklistBytes)
+	pinned, err := hex.DecodeString(options.SHA256)
+	if err != nil || subtle.ConstantTimeCompare(digest[:], pinned) != 1 {
+		return fmt.Errorf("%w: SHA-256 is %x, not the pinned %s", errVerificationFailed, digest, options.SHA256)
+	}
+	return nil
+}
+
+// verifySignedBy checks that signature is a signature of blocklistBytes by one of the keys in options.
+func verifySignedBy(options SourceOptions, blocklistBytes []byte, signature []byte) error {
+	keys := make([]publicKey, 0, len(options.PublicKeys))
+	for _, encoded := range options.PublicKeys {
+		key, err := parsePublicKey(encoded)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	return verifySignature(blocklistBytes, signature, keys)
+}
+
+// defaultSignatureLocation is where minisign puts the signature of location, next to it with .minisig appended.
+func defaultSignatureLocation(location string) string {
+	uri, err := url.Parse(location)
+	if err != nil {
+		return location + ".minisig"
+	}
+	if uri.Scheme == gitScheme {
+		query := uri.Query()
+		query.Set("path", query.Get("path")+".minisig")
+		uri.RawQuery = query.Encode()
+		return uri.String()
+	}
+	uri.Path += ".minisig"
+	uri.RawPath = ""
+	return uri.String()
+}
+
+// verifySignature checks that signature is a signature of message by one of keys. signature is either a minisign
+// signature file or a base64 encoded bare Ed25519 signature.
+func verifySignature(message, signature []byte, keys []publicKey) error {
+	if !bytes.HasPrefix(signature, []byte("untrusted comment:")) {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil || len(decoded) != ed25519.SignatureSize {
+			return errors.New("neither a minisign nor a base64 encoded Ed25519 signature")
+		}
+		for _, key := range keys {
+			if key.id == nil && ed25519.Verify(key.key, message, decoded) {
+				return nil
+			}
+		}
+		return errors.New("not signed by any of the Ed25519 keys")
+	}
+
+	// untrusted comment, signature, trusted comment, global signature over signature and trusted comment
+	lines := strings.Split(strings.ReplaceAll(string(signature), "\r\n", "\n"), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("malformed minisign signature")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(decoded) != 2+8+ed25519.SignatureSize {
+		return errors.New("malformed minisign signature")
+	}
+	globalSignature, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(globalSignature) != ed25519.SignatureSize {
+		return errors.New("malformed minisign global signature")
+	}
+	algorithm, keyId, signed := string(decoded[:2]), decoded[2:10], decoded[10:]
+
+	switch algorithm {
+	case "Ed":
+	case "ED": // Prehashed, the default since minisign 0.10
+		digest := blake2b.Sum512(message)
+		message = digest[:]
+	default:
+		return fmt.Errorf("unsupported minisign signature algorithm %q", algorithm)
+	}
+	for _, key := range keys {
+		if !bytes.Equal(key.id, keyId) {
+			continue
+		}
+		if !ed25519.Verify(key.key, message, signed) {
+			return errors.New("minisign signature doesn't match")
+		}
+		trustedComment := strings.TrimPrefix(lines[2], "trusted comment: ")
+		if !ed25519.Verify(key.key, append(bytes.Clone(signed), trustedComment...), globalSignature) {
+			return errors.New("minisign trusted comment doesn't match")
+		}
+		return nil
+	}
+	printedId := slices.Clone(keyId)
+	slices.Reverse(printedId) // minisign prints key IDs little endian
+	return fmt.Errorf("signed by minisign key %X, which isn't configured", printedId)
+}
+
+// lastLine returns the last line of encoded that isn't empty, which skips the comment of minisign key files.
+func lastLine(encoded string) string {
+	lines := strings.Split(strings.TrimSpace(encoded), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
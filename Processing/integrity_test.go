@@ -0,0 +1,211 @@
+package Processing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/blake2b"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// minisignKey is a key pair in the layout minisign uses.
+type minisignKey struct {
+	id      []byte
+	private ed25519.PrivateKey
+	public  string
+}
+
+func newMinisignKey(t *testing.T, id string) minisignKey {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), id...), public...))
+	return minisignKey{id: []byte(id), private: private, public: "untrusted comment: minisign public key\n" + encoded + "\n"}
+}
+
+// sign signs message like minisign -S does, prehashed unless legacy is set.
+func (key minisignKey) sign(message []byte, legacy bool, trustedComment string) []byte {
+	algorithm := "ED"
+	if legacy {
+		algorithm = "Ed"
+	} else {
+		digest := blake2b.Sum512(message)
+		message = digest[:]
+	}
+	signature := ed25519.Sign(key.private, message)
+	global := ed25519.Sign(key.private, append(append([]byte(nil), signature...), trustedComment...))
+	return []byte("untrusted comment: signature from minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(append(append([]byte(algorithm), key.id...), signature...)) + "\n" +
+		"trusted comment: " + trustedComment + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n")
+}
+
+func Test_verifySignature(t *testing.T) {
+	message := []byte("title = \"AGBTest\"\n")
+	signer := newMinisignKey(t, "AGBSign1")
+	other := newMinisignKey(t, "AGBSign2")
+	barePublic, barePrivate, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bareKey := base64.StdEncoding.EncodeToString(barePublic)
+	bareSignature := []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(barePrivate, message)) + "\n")
+
+	tampered := bytes.Replace(signer.sign(message, false, "timestamp:1718000000"), []byte("timestamp:1718000000"),
+		[]byte("timestamp:1718000001"), 1)
+
+	tests := []struct {
+		name      string
+		signature []byte
+		keys      []string
+		wantErr   bool
+	}{
+		{"minisign prehashed", signer.sign(message, false, "timestamp:1718000000"), []string{other.public, signer.public}, false},
+		{"minisign legacy", signer.sign(message, true, "timestamp:1718000000"), []string{signer.public}, false},
+		{"minisign unknown key", signer.sign(message, false, "timestamp:1718000000"), []string{other.public}, true},
+		{"minisign other message", signer.sign([]byte("title = \"Other\"\n"), false, "timestamp:1718000000"), []string{signer.public}, true},
+		{"minisign tampered trusted comment", tampered, []string{signer.public}, true},
+		{"bare ed25519", bareSignature, []string{signer.public, bareKey}, false},
+		{"bare ed25519 wrong key", bareSignature, []string{base64.StdEncoding.EncodeToString(make([]byte, ed25519.PublicKeySize))}, true},
+		{"garbage", []byte("not a signature"), []string{bareKey}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var keys []publicKey
+			for _, encoded := range tt.keys {
+				key, err := parsePublicKey(encoded)
+				if err != nil {
+					t.Fatal(err)
+				}
+				keys = append(keys, key)
+			}
+			if err := verifySignature(message, tt.signature, keys); (err != nil) != tt.wantErr {
+				t.Errorf("verifySignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidatePublicKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{"minisign line", "RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3", false},
+		{"minisign file", "untrusted comment: minisign public key 79E7620F18C2E81F\nRWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3\n", false},
+		{"bare ed25519", base64.StdEncoding.EncodeToString(make([]byte, ed25519.PublicKeySize)), false},
+		{"too short", base64.StdEncoding.EncodeToString(make([]byte, 16)), true},
+		{"not base64", "RWQf6LRCGA9i53ml!", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidatePublicKey(tt.key); (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePublicKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_loadSourceRefusesUnverified(t *testing.T) {
+	Cache.SetDirectory(t.TempDir())
+	defer Cache.SetDirectory("")
+
+	directory := t.TempDir()
+	signed := filepath.Join(directory, "AGBSigned.toml")
+	pinned := filepath.Join(directory, "AGBPinned.toml")
+	write := func(path string, content []byte) {
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	content := []byte("title = \"AGBTest\"\n[[block]]\nfriendly_name = \"Test\"\nworld_id = \"wrld_00000000-0000-0000-0000-000000000000\"\ngame_objects = [{ name = \"Poster\" }]\n")
+	digest := sha256.Sum256(content)
+	key := newMinisignKey(t, "AGBSign1")
+	write(signed, content)
+	write(signed+".minisig", key.sign(content, false, "timestamp:1718000000"))
+	write(pinned, content)
+
+	SetSourceOptions(map[string]SourceOptions{
+		"file://" + signed: {PublicKeys: []string{key.public}},
+		"file://" + pinned: {SHA256: hex.EncodeToString(digest[:])},
+	})
+	defer SetSourceOptions(nil)
+	locations := []string{"file://" + signed, "file://" + pinned}
+
+	_, results, _ := GenerateObjectIndex(locations)
+	for _, result := range results {
+		assert.Empty(t, result.Error, result.Location)
+	}
+
+	// Swapped out without a new signature or digest, the last verified copy has to stay in the index
+	tamperedContent := append(content, []byte("\n[[block]]\nfriendly_name = \"Injected\"\nworld_id = \"wrld_11111111-1111-1111-1111-111111111111\"\ngame_objects = [{ name = \"Poster\" }]\n")...)
+	write(signed, tamperedContent)
+	write(pinned, tamperedContent)
+	mapping, results, blocklists := GenerateObjectIndex(locations)
+	assert.Len(t, mapping, 1, "tampered copies mustn't be indexed")
+	for i, result := range results {
+		assert.True(t, result.FromCache, result.Location)
+		_, err := verifySource(result.Location, sourceOptionsFor(result.Location), tamperedContent, "")
+		assert.ErrorIs(t, err, errVerificationFailed)
+		assert.Equal(t, contentRevision(content), blocklists[i].Revision)
+	}
+}
+
+func Test_loadSourceVerifiesCopiesItDoesntFetch(t *testing.T) {
+	Cache.SetDirectory(t.TempDir())
+	defer Cache.SetDirectory("")
+	defer SetSourceOptions(nil)
+
+	content := []byte("title = \"AGBTest\"\n[[block]]\nfriendly_name = \"Test\"\nworld_id = \"wrld_00000000-0000-0000-0000-000000000000\"\ngame_objects = [{ name = \"Poster\" }]\n")
+	key := newMinisignKey(t, "AGBSign1")
+	signature := key.sign(content, false, "timestamp:1718000000")
+	var unavailable atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case unavailable.Load():
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/AGBTest.toml.minisig":
+			w.Write(signature)
+		case r.Header.Get("If-None-Match") == `"v1"`:
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			w.Header().Set("ETag", `"v1"`)
+			w.Write(content)
+		}
+	}))
+	defer server.Close()
+	location := server.URL + "/AGBTest.toml"
+	load := func(options SourceOptions) SourceResult {
+		SetSourceOptions(map[string]SourceOptions{location: options})
+		_, result, _ := loadSource(location)
+		return result
+	}
+
+	assert.Empty(t, load(SourceOptions{}).Error)
+	assert.True(t, load(SourceOptions{}).NotModified)
+	result := load(SourceOptions{SHA256: strings.Repeat("0", 64)})
+	assert.Contains(t, result.Error, "not the pinned", "a pin added later has to apply to an unchanged source")
+	assert.False(t, result.FromCache, "the cached copy doesn't match the pin either")
+	assert.Zero(t, result.Revision)
+
+	signed := SourceOptions{PublicKeys: []string{key.public}}
+	assert.Empty(t, load(signed).Error)
+	unavailable.Store(true)
+	result = load(signed)
+	assert.True(t, result.FromCache, "the cached copy should pass with the signature kept alongside it")
+	assert.Equal(t, contentRevision(content), result.Revision)
+	result = load(SourceOptions{PublicKeys: []string{newMinisignKey(t, "AGBSign2").public}})
+	assert.False(t, result.FromCache, "the cached copy isn't signed by the key configured now")
+	assert.Contains(t, result.Error, "503")
+}
@@ -0,0 +1,138 @@
+package Processing
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// LintFinding is a problem found in a blocklist.
+type LintFinding struct {
+	Location string
+	// Check names what was checked, one of the Lint* constants.
+	Check string
+	// Block is the position of the offending [[block]] in the list, counting from 1. 0 if the finding is about the
+	// list as a whole.
+	Block   int    `json:",omitempty"`
+	WorldId string `json:",omitempty"`
+	Object  string `json:",omitempty"`
+	Message string
+}
+
+func (finding LintFinding) String() string {
+	switch {
+	case finding.Block == 0:
+		return fmt.Sprintf("%s: %s [%s]", finding.Location, finding.Message, finding.Check)
+	case finding.WorldId == "":
+		return fmt.Sprintf("%s: block %d: %s [%s]", finding.Location, finding.Block, finding.Message, finding.Check)
+	default:
+		return fmt.Sprintf("%s: block %d (%s): %s [%s]", finding.Location, finding.Block, finding.WorldId, finding.Message, finding.Check)
+	}
+}
+
+const (
+	LintUnreadable      = "unreadable"
+	LintDuplicateWorld  = "duplicate-world"
+	LintDuplicateObject = "duplicate-object"
+	LintWorldId         = "world-id"
+	LintEmptyBlock      = "empty-block"
+	LintFriendlyName    = "friendly-name"
+	LintPosition        = "position"
+)
+
+// LintSource is a parsed blocklist and where it came from.
+type LintSource struct {
+	Location  string
+	Blocklist Blocklist
+}
+
+var worldIdPattern = regexp.MustCompile(`^wrld_[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// LintLocations fetches and checks the blocklists at locations, see LintBlocklists. Blocklists that can't be
+// fetched or decoded are reported as unreadable.
+func LintLocations(locations []string) (findings []LintFinding) {
+	var sources []LintSource
+	for _, location := range locations {
+		blocklistBytes, validators, err := fetchBlocklistBytes(location, httpValidators{})
+		var blocklistObject Blocklist
+		if err == nil {
+			// Not parseBlocklist, what it refuses is reported in more detail below
+			blocklistObject, err = decodeBlocklist(blocklistBytes, blocklistFormat(location, validators.ContentType))
+		}
+		if err != nil {
+			findings = append(findings, LintFinding{Location: location, Check: LintUnreadable, Message: err.Error()})
+			continue
+		}
+		sources = append(sources, LintSource{Location: location, Blocklist: blocklistObject})
+	}
+	return append(findings, LintBlocklists(sources)...)
+}
+
+// LintBlocklists checks sources for mistakes that would otherwise only show once they are indexed. Duplicates are
+// looked for within every source, friendly names are compared across all of them.
+func LintBlocklists(sources []LintSource) (findings []LintFinding) {
+	type namedWorld struct {
+		location     string
+		block        int
+		friendlyName string
+	}
+	// firstNames remembers where every world was first named, so conflicting names point back to it
+	firstNames := make(map[string]namedWorld)
+
+	for _, source := range sources {
+		finding := func(block int, worldId, object, check, message string, args ...any) {
+			findings = append(findings, LintFinding{Location: source.Location, Check: check, Block: block,
+				WorldId: worldId, Object: object, Message: fmt.Sprintf(message, args...)})
+		}
+
+		worldBlocks := make(map[string]int)
+		objectBlocks := make(map[string]int)
+		for i, block := range source.Blocklist.Blocks {
+			blockNumber := i + 1
+			if !worldIdPattern.MatchString(block.WorldId) {
+				finding(blockNumber, block.WorldId, "", LintWorldId, "world ID %q isn't of the form wrld_<uuid>", block.WorldId)
+			}
+			if first, exists := worldBlocks[block.WorldId]; exists {
+				finding(blockNumber, block.WorldId, "", LintDuplicateWorld, "world is already listed in block %d", first)
+			} else {
+				worldBlocks[block.WorldId] = blockNumber
+			}
+			if len(block.GameObjects) == 0 {
+				finding(blockNumber, block.WorldId, "", LintEmptyBlock, "block has no game_objects")
+			}
+
+			if named, exists := firstNames[block.WorldId]; !exists {
+				firstNames[block.WorldId] = namedWorld{location: source.Location, block: blockNumber, friendlyName: block.FriendlyName}
+			} else if named.friendlyName != block.FriendlyName {
+				finding(blockNumber, block.WorldId, "", LintFriendlyName, "world is named %q here but %q in block %d of %s",
+					block.FriendlyName, named.friendlyName, named.block, named.location)
+			}
+
+			for _, object := range block.GameObjects {
+				finite := finitePosition(object.Position)
+				if !finite {
+					finding(blockNumber, block.WorldId, object.Name, LintPosition, "object %q has a position that isn't finite: %v",
+						object.Name, *object.Position)
+				}
+				for parent := object.Parent; parent != nil; parent = parent.Parent {
+					if !finitePosition(parent.Position) {
+						finite = false
+						finding(blockNumber, block.WorldId, object.Name, LintPosition, "parent %q of object %q has a position that isn't finite: %v",
+							parent.Name, object.Name, *parent.Position)
+					}
+				}
+				if !finite {
+					continue // Can't be hashed
+				}
+
+				// Objects are told apart by their hash, so only objects identical in every field are duplicates
+				key := HashWorldId(block.WorldId) + HashGameobject(object)
+				if first, exists := objectBlocks[key]; exists {
+					finding(blockNumber, block.WorldId, object.Name, LintDuplicateObject, "object %q is already listed in block %d", object.Name, first)
+				} else {
+					objectBlocks[key] = blockNumber
+				}
+			}
+		}
+	}
+	return findings
+}
@@ -0,0 +1,105 @@
+package Processing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLintBlocklists(t *testing.T) {
+	const worldId = "wrld_4cf554b4-430c-4f8f-b53e-1f294eed230b"
+	poster := Gameobject{Name: "Poster (9)"}
+	block := func(friendlyName, worldId string, objects ...Gameobject) Block {
+		return Block{FriendlyName: friendlyName, WorldId: worldId, GameObjects: objects}
+	}
+	type found struct {
+		location, check string
+		block           int
+	}
+
+	tests := []struct {
+		name    string
+		sources []LintSource
+		want    []found
+	}{
+		{
+			name:    "clean",
+			sources: []LintSource{{Location: "a", Blocklist: Blocklist{Blocks: []Block{block("Just B Club 3", worldId, poster)}}}},
+		},
+		{
+			name: "same world in different lists",
+			sources: []LintSource{
+				{Location: "a", Blocklist: Blocklist{Blocks: []Block{block("Just B Club 3", worldId, poster)}}},
+				{Location: "b", Blocklist: Blocklist{Blocks: []Block{block("Just B Club 3", worldId, poster)}}},
+			},
+		},
+		{
+			name: "duplicate world and object",
+			sources: []LintSource{{Location: "a", Blocklist: Blocklist{Blocks: []Block{
+				block("Just B Club 3", worldId, poster, Gameobject{Name: "Poster (9)", Parent: &Gameobject{Name: "Wall"}}),
+				block("Just B Club 3", worldId, poster),
+			}}}},
+			want: []found{{"a", LintDuplicateWorld, 2}, {"a", LintDuplicateObject, 2}},
+		},
+		{
+			name: "malformed world ID and empty block",
+			sources: []LintSource{{Location: "a", Blocklist: Blocklist{Blocks: []Block{
+				block("Just B Club 3", "4cf554b4-430c-4f8f-b53e-1f294eed230b"),
+			}}}},
+			want: []found{{"a", LintWorldId, 1}, {"a", LintEmptyBlock, 1}},
+		},
+		{
+			name: "conflicting friendly names",
+			sources: []LintSource{
+				{Location: "a", Blocklist: Blocklist{Blocks: []Block{block("Just B Club 3", worldId, poster)}}},
+				{Location: "b", Blocklist: Blocklist{Blocks: []Block{block("Just B Club", worldId, poster)}}},
+			},
+			want: []found{{"b", LintFriendlyName, 1}},
+		},
+		{
+			name: "non-finite positions",
+			sources: []LintSource{{Location: "a", Blocklist: Blocklist{Blocks: []Block{
+				block("Just B Club 3", worldId,
+					Gameobject{Name: "Lamp", Position: &GameobjectPosition{X: math.NaN()}},
+					Gameobject{Name: "Image", Parent: &Gameobject{Name: "Panel", Position: &GameobjectPosition{Y: math.Inf(-1)}}},
+					Gameobject{Name: "Image", Parent: &Gameobject{Name: "Panel", Position: &GameobjectPosition{Y: math.Inf(-1)}}}),
+			}}}},
+			want: []found{{"a", LintPosition, 1}, {"a", LintPosition, 1}, {"a", LintPosition, 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []found
+			for _, finding := range LintBlocklists(tt.sources) {
+				got = append(got, found{finding.Location, finding.Check, finding.Block})
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLintLocations(t *testing.T) {
+	directory := t.TempDir()
+	write := func(name, content string) string {
+		if err := os.WriteFile(filepath.Join(directory, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return "file://" + filepath.Join(directory, name)
+	}
+	nan := write("nan.toml", "title = \"NaN\"\n[[block]]\nfriendly_name = \"Test\"\n"+
+		"world_id = \"wrld_00000000-0000-0000-0000-000000000000\"\ngame_objects = [{ name = \"Lamp\", position = { x = nan, y = 0, z = 0 } }]\n")
+	broken := write("broken.toml", "title = ")
+
+	findings := LintLocations([]string{nan, broken})
+	if assert.Len(t, findings, 2) {
+		assert.Equal(t, LintFinding{Location: broken, Check: LintUnreadable, Message: findings[0].Message}, findings[0])
+		assert.Equal(t, LintFinding{Location: nan, Check: LintPosition, Block: 1, WorldId: "wrld_00000000-0000-0000-0000-000000000000",
+			Object: "Lamp", Message: `object "Lamp" has a position that isn't finite: {NaN 0 0}`}, findings[1])
+	}
+
+	// The server has to refuse what lint warns about instead of failing to hash it
+	_, err := FetchBlocklist(nan)
+	assert.ErrorContains(t, err, "isn't finite")
+}
@@ -0,0 +1,74 @@
+package Processing
+
+import "container/list"
+
+// boundedLRU maps keys to values and forgets the least recently used once it holds more than maxEntries. Without a
+// positive maxEntries it's unbounded. It isn't safe for concurrent use.
+type boundedLRU[K comparable, V any] struct {
+	maxEntries int
+	entries    map[K]*list.Element
+	// recent orders entries from most to least recently used
+	recent *list.List
+	// onEvict is called with every entry forgotten to make room, if set.
+	onEvict func(key K, value V)
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+func newBoundedLRU[K comparable, V any](maxEntries int) *boundedLRU[K, V] {
+	return &boundedLRU[K, V]{
+		maxEntries: maxEntries,
+		entries:    make(map[K]*list.Element),
+		recent:     list.New(),
+	}
+}
+
+// get returns the value of key and marks it as most recently used.
+func (lru *boundedLRU[K, V]) get(key K) (V, bool) {
+	element, exists := lru.entries[key]
+	if !exists {
+		var zero V
+		return zero, false
+	}
+	lru.recent.MoveToFront(element)
+	return element.Value.(*lruEntry[K, V]).value, true
+}
+
+// add stores value as most recently used under key, which mustn't be stored yet, making room if necessary.
+func (lru *boundedLRU[K, V]) add(key K, value V) {
+	lru.entries[key] = lru.recent.PushFront(&lruEntry[K, V]{key: key, value: value})
+	for lru.maxEntries > 0 && lru.recent.Len() > lru.maxEntries {
+		oldest := lru.recent.Remove(lru.recent.Back()).(*lruEntry[K, V])
+		delete(lru.entries, oldest.key)
+		if lru.onEvict != nil {
+			lru.onEvict(oldest.key, oldest.value)
+		}
+	}
+}
+
+// oldest returns the least recently used entry without marking it as used.
+func (lru *boundedLRU[K, V]) oldest() (K, V, bool) {
+	element := lru.recent.Back()
+	if element == nil {
+		var key K
+		var value V
+		return key, value, false
+	}
+	entry := element.Value.(*lruEntry[K, V])
+	return entry.key, entry.value, true
+}
+
+// remove forgets key without calling onEvict.
+func (lru *boundedLRU[K, V]) remove(key K) {
+	if element, exists := lru.entries[key]; exists {
+		lru.recent.Remove(element)
+		delete(lru.entries, key)
+	}
+}
+
+func (lru *boundedLRU[K, V]) len() int {
+	return lru.recent.Len()
+}
@@ -0,0 +1,34 @@
+package Processing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBoundedLRU(t *testing.T) {
+	lru := newBoundedLRU[string, int](2)
+	var evicted []string
+	lru.onEvict = func(key string, value int) { evicted = append(evicted, key) }
+
+	lru.add("first", 1)
+	lru.add("second", 2)
+	value, exists := lru.get("first")
+	assert.True(t, exists)
+	assert.Equal(t, 1, value)
+	lru.add("third", 3)
+
+	assert.Equal(t, 2, lru.len())
+	assert.Equal(t, []string{"second"}, evicted, "the least recently used entry should make room")
+	_, exists = lru.get("second")
+	assert.False(t, exists)
+	_, exists = lru.get("first")
+	assert.True(t, exists)
+}
+
+func TestBoundedLRUUnbounded(t *testing.T) {
+	lru := newBoundedLRU[int, int](0)
+	for i := range 100 {
+		lru.add(i, i)
+	}
+	assert.Equal(t, 100, lru.len())
+}
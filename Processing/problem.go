@@ -0,0 +1,32 @@
+package Processing
+
+import (
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// Problem is an RFC 7807 problem detail, handlers return it as error to have it sent as application/problem+json.
+type Problem struct {
+	Type   string `json:"type,omitempty"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// InvalidParams lists what exactly was wrong with a request that failed validation.
+	InvalidParams []InvalidParam `json:"invalid-params,omitempty"`
+}
+
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// NewProblem returns a problem titled after status.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Title: utils.StatusMessage(status), Status: status, Detail: detail}
+}
+
+func (problem *Problem) Error() string {
+	if problem.Detail == "" {
+		return problem.Title
+	}
+	return problem.Title + ": " + problem.Detail
+}
@@ -2,16 +2,36 @@ package Processing
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"sync/atomic"
+	"time"
 )
 
 var (
-	ChosenReceiver Receiver
-	ChosenPusher   Pusher
+	receivers    atomic.Pointer[Fanout]
+	ingest       atomic.Pointer[IngestQueue]
+	chosenPusher atomic.Value
+	missFilters  atomic.Pointer[[]MissFilter]
 )
 
 // A Receiver is the actual endpoint that gets the blocklist data.
 type Receiver interface {
-	SendToRemote(misses []Gameobject, world *WorldObject)
+	SendToRemote(report MissReport) error
+}
+
+// An AsyncErrorReporter is a Receiver that only finds out about failed deliveries after SendToRemote returned.
+type AsyncErrorReporter interface {
+	SetErrorCallback(onError func(error))
+}
+
+// An AsyncWriteTimer is a Receiver that writes after SendToRemote returned, so it times its writes itself.
+type AsyncWriteTimer interface {
+	SetWriteCallback(onWrite func(took time.Duration))
+}
+
+// A MissFilter decides which misses of a callback are passed on to the receivers. It may hold misses back, merge
+// them or annotate them, but must not modify misses in place.
+type MissFilter interface {
+	Filter(callback IncomingCallback, misses []Miss) []Miss
 }
 
 // A Pusher is something that pushes data to the BlocklistSrv.
@@ -19,3 +39,51 @@ type Pusher interface {
 	HandlePushRequest(c *fiber.Ctx) error
 	CanPusherOperate() bool
 }
+
+// atomic.Value refuses to store different concrete types, so the interface gets wrapped.
+type pusherHolder struct{ Pusher }
+
+// Receivers returns the fanout misses are currently sent to.
+func Receivers() *Fanout {
+	return receivers.Load()
+}
+
+// SetReceivers swaps the fanout misses are sent to and returns the previous one, which the caller has to Close.
+// This is safe to call while callbacks are being handled.
+func SetReceivers(fanout *Fanout) (previous *Fanout) {
+	return receivers.Swap(fanout)
+}
+
+// Ingest returns the queue callbacks are currently submitted to.
+func Ingest() *IngestQueue {
+	return ingest.Load()
+}
+
+// SetIngest swaps the queue callbacks are submitted to and returns the previous one, which the caller has to Close.
+func SetIngest(queue *IngestQueue) (previous *IngestQueue) {
+	return ingest.Swap(queue)
+}
+
+// ChosenPusher returns the pusher currently responsible for push requests.
+func ChosenPusher() Pusher {
+	holder, _ := chosenPusher.Load().(pusherHolder)
+	return holder.Pusher
+}
+
+// SetPusher swaps the pusher responsible for push requests.
+func SetPusher(pusher Pusher) {
+	chosenPusher.Store(pusherHolder{pusher})
+}
+
+// MissFilters returns the filters misses currently pass through, in order.
+func MissFilters() []MissFilter {
+	if filters := missFilters.Load(); filters != nil {
+		return *filters
+	}
+	return nil
+}
+
+// SetMissFilters swaps the filters misses pass through. Whatever the previous filters held back is forgotten.
+func SetMissFilters(filters ...MissFilter) {
+	missFilters.Store(&filters)
+}
@@ -0,0 +1,95 @@
+package Processing
+
+import (
+	"AGB-BlocklistSrv/Metrics"
+	"sync"
+	"time"
+)
+
+// Quorum is a MissFilter holding misses back until enough distinct reporters reported them within a window, so
+// a single buggy or malicious client can't make an entry look broken. Once there are enough, every report of the
+// miss is passed on, annotated with how many reporters there were.
+//
+// It remembers up to maxEntries misses, the least recently reported are forgotten first, and up to threshold reporters
+// per miss. Once a miss has that many, the one that reported longest ago makes room for the next and is only counted
+// from then on, so a reporter coming back after it was forgotten counts twice.
+type Quorum struct {
+	mutex     sync.Mutex
+	threshold int
+	window    time.Duration
+	entries   *boundedLRU[quorumKey, *quorumEntry]
+}
+
+type quorumKey struct {
+	world, object string
+}
+
+type quorumEntry struct {
+	// reporters maps every reporter within the window to when it last reported the miss
+	reporters map[string]time.Time
+	// forgotten counts reporters that made room for others, up to forgottenAt they were all within the window
+	forgotten   int
+	forgottenAt time.Time
+}
+
+// NewQuorum holds misses back until threshold distinct reporters reported them within window.
+func NewQuorum(threshold int, window time.Duration, maxEntries int) *Quorum {
+	return &Quorum{
+		threshold: threshold,
+		window:    window,
+		entries:   newBoundedLRU[quorumKey, *quorumEntry](maxEntries),
+	}
+}
+
+func (quorum *Quorum) Filter(callback IncomingCallback, misses []Miss) []Miss {
+	quorum.mutex.Lock()
+	defer quorum.mutex.Unlock()
+
+	forwarded := make([]Miss, 0, len(misses))
+	for _, miss := range misses {
+		reporters := quorum.report(quorumKey{world: callback.WorldId, object: miss.Hash}, callback.Reporter, callback.ReceivedAt)
+		if reporters < quorum.threshold {
+			Metrics.MissesAwaitingQuorum.Inc()
+			continue
+		}
+		miss.Reporters = reporters
+		forwarded = append(forwarded, miss)
+	}
+	return forwarded
+}
+
+// report records that reporter reported the miss at key and returns how many distinct reporters did within the window.
+func (quorum *Quorum) report(key quorumKey, reporter string, at time.Time) int {
+	entry, exists := quorum.entries.get(key)
+	if !exists {
+		entry = &quorumEntry{reporters: make(map[string]time.Time)}
+		quorum.entries.add(key, entry)
+	}
+
+	var oldestReporter string
+	var oldestReportedAt time.Time
+	for known, reportedAt := range entry.reporters {
+		if at.Sub(reportedAt) >= quorum.window {
+			delete(entry.reporters, known)
+		} else if oldestReportedAt.IsZero() || reportedAt.Before(oldestReportedAt) {
+			oldestReporter, oldestReportedAt = known, reportedAt
+		}
+	}
+	if entry.forgotten > 0 && at.Sub(entry.forgottenAt) >= quorum.window {
+		entry.forgotten = 0
+	}
+	if _, known := entry.reporters[reporter]; !known && len(entry.reporters) >= max(quorum.threshold, 1) {
+		delete(entry.reporters, oldestReporter)
+		entry.forgotten++
+		entry.forgottenAt = at
+	}
+	entry.reporters[reporter] = at
+	return len(entry.reporters) + entry.forgotten
+}
+
+// Len returns how many misses are currently remembered.
+func (quorum *Quorum) Len() int {
+	quorum.mutex.Lock()
+	defer quorum.mutex.Unlock()
+	return quorum.entries.len()
+}
@@ -0,0 +1,50 @@
+package Processing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestQuorum(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	report := func(quorum *Quorum, reporter string, after time.Duration) []Miss {
+		return quorum.Filter(IncomingCallback{
+			CallbackContainer: CallbackContainer{WorldId: "world"},
+			Reporter:          reporter,
+			ReceivedAt:        start.Add(after),
+		}, []Miss{{Gameobject: Gameobject{Name: "Cube"}, Hash: "cube"}})
+	}
+
+	quorum := NewQuorum(3, time.Hour, 0)
+	assert.Empty(t, report(quorum, "alice", 0))
+	assert.Empty(t, report(quorum, "alice", time.Minute), "the same reporter shouldn't count twice")
+	assert.Empty(t, report(quorum, "bob", 2*time.Minute))
+	forwarded := report(quorum, "carol", 3*time.Minute)
+	if assert.Len(t, forwarded, 1, "third reporter should reach quorum") {
+		assert.Equal(t, 3, forwarded[0].Reporters)
+	}
+
+	forwarded = report(quorum, "dave", 4*time.Minute)
+	if assert.Len(t, forwarded, 1) {
+		assert.Equal(t, 4, forwarded[0].Reporters, "reporters beyond the quorum should still be counted")
+	}
+	forwarded = report(quorum, "dave", 5*time.Minute)
+	if assert.Len(t, forwarded, 1) {
+		assert.Equal(t, 4, forwarded[0].Reporters, "a remembered reporter shouldn't count twice")
+	}
+	entry, _ := quorum.entries.get(quorumKey{world: "world", object: "cube"})
+	assert.Len(t, entry.reporters, 3,
+		"no more reporters than the quorum should be remembered")
+
+	assert.Empty(t, report(quorum, "erin", 2*time.Hour), "reports outside the window shouldn't count")
+}
+
+func TestQuorumBoundsEntries(t *testing.T) {
+	quorum := NewQuorum(2, time.Hour, 2)
+	now := time.Now()
+	for _, object := range []string{"cube", "sphere", "cylinder"} {
+		quorum.Filter(IncomingCallback{Reporter: "alice", ReceivedAt: now}, []Miss{{Hash: object}})
+	}
+	assert.Equal(t, 2, quorum.Len())
+}
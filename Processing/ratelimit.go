@@ -0,0 +1,72 @@
+package Processing
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter hands out tokens per key from buckets refilling at a fixed rate. It only remembers up to maxKeys
+// buckets, so a flood of distinct keys can't exhaust memory. The least recently used are forgotten first, which only
+// ever errs towards letting requests through.
+type RateLimiter struct {
+	mutex   sync.Mutex
+	rate    float64
+	burst   float64
+	buckets *boundedLRU[string, *tokenBucket]
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter allows rate requests per second and key, with bursts of up to burst requests.
+// A rate of 0 or less allows everything.
+func NewRateLimiter(rate float64, burst int, maxKeys int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: newBoundedLRU[string, *tokenBucket](maxKeys),
+	}
+}
+
+// Allow takes a token from key's bucket. If there is none, it returns how long until there will be.
+func (limiter *RateLimiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	if limiter.rate <= 0 {
+		return true, 0
+	}
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	bucket, exists := limiter.buckets.get(key)
+	if !exists {
+		bucket = &tokenBucket{tokens: limiter.burst, updated: now}
+		limiter.buckets.add(key, bucket)
+	}
+	limiter.refill(bucket, now)
+
+	if bucket.tokens < 1 {
+		wait := (1 - bucket.tokens) / limiter.rate
+		return false, time.Duration(math.Ceil(wait * float64(time.Second)))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+func (limiter *RateLimiter) refill(bucket *tokenBucket, now time.Time) {
+	if elapsed := now.Sub(bucket.updated).Seconds(); elapsed > 0 {
+		bucket.tokens = math.Min(limiter.burst, bucket.tokens+elapsed*limiter.rate)
+		bucket.updated = now
+	}
+}
+
+// Len returns how many buckets are currently remembered.
+func (limiter *RateLimiter) Len() int {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	return limiter.buckets.len()
+}
@@ -0,0 +1,60 @@
+package Processing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(1, 2, 0)
+
+	for i := 0; i < 2; i++ {
+		allowed, _ := limiter.Allow("client", now)
+		assert.True(t, allowed, "request %d should fit into the burst", i)
+	}
+	allowed, wait := limiter.Allow("client", now)
+	assert.False(t, allowed, "burst should be used up")
+	assert.Equal(t, time.Second, wait)
+
+	allowed, _ = limiter.Allow("other client", now)
+	assert.True(t, allowed, "keys should have separate buckets")
+
+	allowed, _ = limiter.Allow("client", now.Add(time.Second))
+	assert.True(t, allowed, "bucket should have refilled a token")
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	limiter := NewRateLimiter(0, 0, 0)
+	for i := 0; i < 100; i++ {
+		allowed, _ := limiter.Allow("client", time.Now())
+		assert.True(t, allowed)
+	}
+	assert.Zero(t, limiter.Len(), "a disabled limiter shouldn't remember anything")
+}
+
+func TestRateLimiterBoundsKeys(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(1, 5, 10)
+	for i := 0; i < 100; i++ {
+		limiter.Allow(strconv.Itoa(i), now)
+	}
+	assert.LessOrEqual(t, limiter.Len(), 10)
+}
+
+func TestRateLimiterForgetsLeastRecentlyUsed(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(1, 1, 2)
+	limiter.Allow("active", now)
+	limiter.Allow("idle", now)
+	limiter.Allow("active", now)
+	limiter.Allow("new", now)
+
+	assert.Equal(t, 2, limiter.Len())
+	allowed, _ := limiter.Allow("active", now)
+	assert.False(t, allowed, "recently used bucket should be kept")
+	allowed, _ = limiter.Allow("idle", now)
+	assert.True(t, allowed, "least recently used bucket should be forgotten")
+}
@@ -0,0 +1,48 @@
+package Processing
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/netip"
+)
+
+// reporterSalt is random per process, so reporter identities can't be matched up across restarts or against
+// addresses from elsewhere.
+var reporterSalt = func() []byte {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
+	}
+	return salt
+}()
+
+// ReporterFromAddress identifies a reporter by the address it connects from, without keeping the address around.
+// IPv6 clients are identified by their /64, as they tend to rotate through addresses within it.
+func ReporterFromAddress(addr netip.Addr) string {
+	if !addr.IsValid() {
+		return ""
+	}
+	addr = addr.Unmap()
+	if addr.Is6() {
+		addr = netip.PrefixFrom(addr, 64).Masked().Addr()
+	}
+	return anonymise(addr.AsSlice())
+}
+
+// ReporterFromInstallId identifies a reporter by the install ID it sent. Clients choose these freely, so they only
+// tell honest clients apart.
+func ReporterFromInstallId(installId string) string {
+	if installId == "" {
+		return ""
+	}
+	// Prefixed to keep install IDs apart from addresses
+	return anonymise(append([]byte("install:"), installId...))
+}
+
+func anonymise(identity []byte) string {
+	mac := hmac.New(sha256.New, reporterSalt)
+	mac.Write(identity)
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,75 @@
+package Processing
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// A Schedule tells when something is due next, a cron.Schedule is one.
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+// ScheduledSource is a blocklist source and when it should be refreshed.
+type ScheduledSource struct {
+	Location string
+	Schedule Schedule
+	// Jitter delays every refresh by a random duration up to it.
+	Jitter time.Duration
+}
+
+// Scheduler refreshes every source on its own schedule. A source that keeps failing is refreshed less and less
+// often, the delay doubles with every failure in a row up to maxBackoff.
+type Scheduler struct {
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// StartScheduler calls refresh for every source whenever it is due, until Stop is called.
+func StartScheduler(sources []ScheduledSource, maxBackoff time.Duration, refresh func(location string)) *Scheduler {
+	scheduler := &Scheduler{stop: make(chan struct{})}
+	for _, source := range sources {
+		go scheduler.run(source, maxBackoff, refresh)
+	}
+	return scheduler
+}
+
+// Stop ends the schedules. Refreshes that already started are finished in the background.
+func (scheduler *Scheduler) Stop() {
+	scheduler.stopOnce.Do(func() { close(scheduler.stop) })
+}
+
+func (scheduler *Scheduler) run(source ScheduledSource, maxBackoff time.Duration, refresh func(location string)) {
+	for {
+		next := nextAttempt(source, time.Now(), consecutiveFailures(source.Location), maxBackoff)
+		recordNextAttempt(source.Location, next)
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-scheduler.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		refresh(source.Location)
+	}
+}
+
+// nextAttempt returns when source should be refreshed after now, given it failed failures times in a row.
+func nextAttempt(source ScheduledSource, now time.Time, failures int, maxBackoff time.Duration) time.Time {
+	next := source.Schedule.Next(now)
+	if failures > 0 {
+		delay := next.Sub(now)
+		backoff := delay
+		for i := 0; i < failures && backoff < maxBackoff; i++ {
+			backoff *= 2
+		}
+		// A schedule that is further apart than maxBackoff anyway is kept as it is
+		next = now.Add(max(delay, min(backoff, maxBackoff)))
+	}
+	if source.Jitter > 0 {
+		next = next.Add(rand.N(source.Jitter))
+	}
+	return next
+}
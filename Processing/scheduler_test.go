@@ -0,0 +1,70 @@
+package Processing
+
+import (
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_nextAttempt(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	hourly := ScheduledSource{Location: "file:///AGBBase.toml", Schedule: cron.Every(time.Hour)}
+	daily, _ := cron.ParseStandard("0 0 * * *")
+	tests := []struct {
+		name     string
+		source   ScheduledSource
+		failures int
+		want     time.Time
+	}{
+		{name: "healthy", source: hourly, want: now.Add(time.Hour)},
+		{name: "failed once", source: hourly, failures: 1, want: now.Add(2 * time.Hour)},
+		{name: "failed thrice", source: hourly, failures: 3, want: now.Add(8 * time.Hour)},
+		{name: "failing for ages", source: hourly, failures: 100, want: now.Add(24 * time.Hour)},
+		{name: "cron", source: ScheduledSource{Schedule: daily}, want: time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)},
+		{
+			name:     "schedule further apart than the backoff",
+			source:   ScheduledSource{Schedule: cron.Every(48 * time.Hour)},
+			failures: 1,
+			want:     now.Add(48 * time.Hour),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, nextAttempt(tt.source, now, tt.failures, 24*time.Hour))
+		})
+	}
+
+	jittery := ScheduledSource{Schedule: cron.Every(time.Hour), Jitter: time.Minute}
+	next := nextAttempt(jittery, now, 0, 24*time.Hour)
+	assert.False(t, next.Before(now.Add(time.Hour)))
+	assert.True(t, next.Before(now.Add(time.Hour+time.Minute)))
+}
+
+func TestSourceStatuses(t *testing.T) {
+	blocklistPath := filepath.Join(t.TempDir(), "AGBStatus.toml")
+	location := "file://" + blocklistPath
+	if err := os.WriteFile(blocklistPath, []byte("title = \"AGBStatus\"\n[[block]]\nworld_id = \"wrld_status\"\ngame_objects = [{ name = \"Poster\" }, { name = \"Cube\" }]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loadSource(location)
+	status := SourceStatuses([]string{location})[0]
+	assert.Zero(t, status.ConsecutiveFailures)
+	assert.Equal(t, status.LastAttempt, status.LastSuccess)
+	assert.Equal(t, 1, status.Worlds)
+	assert.Equal(t, 2, status.Objects)
+	assert.Positive(t, status.Bytes)
+
+	if err := os.Remove(blocklistPath); err != nil {
+		t.Fatal(err)
+	}
+	loadSource(location)
+	loadSource(location)
+	status = SourceStatuses([]string{location})[0]
+	assert.Equal(t, 2, status.ConsecutiveFailures)
+	assert.NotEmpty(t, status.LastError)
+	assert.True(t, status.LastAttempt.After(status.LastSuccess))
+	assert.Equal(t, []SourceStatus{{Location: "file:///never-fetched.toml"}}, SourceStatuses([]string{"file:///never-fetched.toml"}))
+}
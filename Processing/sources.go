@@ -0,0 +1,126 @@
+package Processing
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SourceOptions are settings for fetching and parsing a single source.
+type SourceOptions struct {
+	// Format is one of the Format* constants, empty to detect it.
+	Format string
+	// SHA256 pins the hex encoded SHA-256 digest the source has to have.
+	SHA256 string
+	// PublicKeys requires the source to be signed by one of them, see ValidatePublicKey.
+	PublicKeys []string
+	// SignatureLocation is where the detached signature is fetched from, next to the source with .minisig appended
+	// by default.
+	SignatureLocation string
+}
+
+func (options SourceOptions) equal(other SourceOptions) bool {
+	return options.Format == other.Format && options.SHA256 == other.SHA256 &&
+		slices.Equal(options.PublicKeys, other.PublicKeys) && options.SignatureLocation == other.SignatureLocation
+}
+
+var sourceOptions atomic.Pointer[map[string]SourceOptions]
+
+// SetSourceOptions replaces the settings of every source, sources missing from options get the defaults. Sources
+// already indexed keep what they were parsed with until they are fetched again, which then doesn't reuse a copy
+// parsed with different settings.
+func SetSourceOptions(options map[string]SourceOptions) {
+	sourceOptions.Store(&options)
+}
+
+func sourceOptionsFor(location string) SourceOptions {
+	if options := sourceOptions.Load(); options != nil {
+		return (*options)[location]
+	}
+	return SourceOptions{}
+}
+
+// SourceStatus describes how refreshing a single blocklist source has been going.
+type SourceStatus struct {
+	Location    string
+	LastAttempt time.Time
+	LastSuccess time.Time
+	LastError   string `json:",omitempty"`
+	// ConsecutiveFailures counts failed attempts since the last successful one.
+	ConsecutiveFailures int
+	// Bytes is how much the last attempt downloaded, 0 if our copy was still current.
+	Bytes   int
+	Worlds  int
+	Objects int
+	// Revision is what the last attempt indexed, see SourceResult.Revision.
+	Revision string `json:",omitempty"`
+	// NextAttempt is when the scheduler refreshes the source next.
+	NextAttempt time.Time
+}
+
+var (
+	sourceStatuses      = map[string]*SourceStatus{}
+	sourceStatusesMutex sync.Mutex
+)
+
+// SourceStatuses returns the status of every source in locations, in the same order.
+func SourceStatuses(locations []string) []SourceStatus {
+	sourceStatusesMutex.Lock()
+	defer sourceStatusesMutex.Unlock()
+	statuses := make([]SourceStatus, 0, len(locations))
+	for _, location := range locations {
+		status := SourceStatus{Location: location}
+		if known, exists := sourceStatuses[location]; exists {
+			status = *known
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// consecutiveFailures returns how often fetching location failed since it last worked.
+func consecutiveFailures(location string) int {
+	sourceStatusesMutex.Lock()
+	defer sourceStatusesMutex.Unlock()
+	if status, exists := sourceStatuses[location]; exists {
+		return status.ConsecutiveFailures
+	}
+	return 0
+}
+
+// recordAttempt updates the status of the source result is for with an attempt to fetch it made at attemptedAt.
+func recordAttempt(result SourceResult, attemptedAt time.Time) {
+	status := lockedSourceStatus(result.Location)
+	defer sourceStatusesMutex.Unlock()
+
+	status.LastAttempt = attemptedAt
+	status.Bytes = result.Bytes
+	status.Worlds, status.Objects = result.Worlds, result.Objects
+	status.Revision = result.Revision
+	if result.Error != "" {
+		status.LastError = result.Error
+		status.ConsecutiveFailures++
+		return
+	}
+	status.LastSuccess = attemptedAt
+	status.LastError = ""
+	status.ConsecutiveFailures = 0
+}
+
+func recordNextAttempt(location string, next time.Time) {
+	status := lockedSourceStatus(location)
+	defer sourceStatusesMutex.Unlock()
+	status.NextAttempt = next
+}
+
+// lockedSourceStatus returns the status of location, creating it if needed. sourceStatusesMutex is left locked.
+func lockedSourceStatus(location string) *SourceStatus {
+	sourceStatusesMutex.Lock()
+	status, exists := sourceStatuses[location]
+	if !exists {
+		status = &SourceStatus{Location: location}
+		sourceStatuses[location] = status
+	}
+	return status
+}
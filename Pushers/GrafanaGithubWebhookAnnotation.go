@@ -1,6 +1,7 @@
 package Pushers
 
 import (
+	"AGB-BlocklistSrv/Metrics"
 	"AGB-BlocklistSrv/Processing"
 	"AGB-BlocklistSrv/config"
 	"crypto/hmac"
@@ -26,10 +27,10 @@ func init() {
 }
 
 type GithubPushWebhookObj struct {
-	Ref        string      `json:"-"`
+	Ref        string      `json:"ref"`
 	Before     string      `json:"-"`
-	After      string      `json:"-"`
-	Repository struct{}    `json:"-"`
+	After      string      `json:"after"`
+	Repository GithubRepo  `json:"repository"`
 	Pusher     struct{}    `json:"-"`
 	Sender     struct{}    `json:"-"`
 	Created    bool        `json:"-"`
@@ -61,6 +62,12 @@ type GithubPushWebhookObj struct {
 	HeadCommit struct{} `json:"-"`
 }
 
+// GithubRepo is how the pushed repository can be cloned, to find local clones of it.
+type GithubRepo struct {
+	CloneUrl string `json:"clone_url"`
+	SshUrl   string `json:"ssh_url"`
+}
+
 func verifyGithubSignature(c *fiber.Ctx) error {
 	sigHeader, exists := c.GetReqHeaders()["X-Hub-Signature-256"]
 	if !exists || len(sigHeader) == 0 {
@@ -71,10 +78,13 @@ func verifyGithubSignature(c *fiber.Ctx) error {
 	hmacObj.Write(c.Body())
 	hmacObjSignature := hmacObj.Sum(nil)
 
-	signatureSplit := strings.Split(sigHeader[0], "=")[1]
-	signature, err := hex.DecodeString(signatureSplit)
+	signatureHex, found := strings.CutPrefix(sigHeader[0], "sha256=")
+	if !found {
+		return fiber.NewError(fiber.StatusUnauthorized, "signature is not in sha256=<hex> form")
+	}
+	signature, err := hex.DecodeString(signatureHex)
 	if err != nil {
-		panic(err)
+		return fiber.NewError(fiber.StatusUnauthorized, "signature is not valid hex")
 	}
 
 	// I believe (armchair cryptography creature, correct me) this comparison is overkill, as knowing the length is not
@@ -99,13 +109,37 @@ func (grafghanno GrafanaGithubWebhookAnnotation) HandlePushRequest(c *fiber.Ctx)
 		}
 	}
 
-	switch c.GetReqHeaders()["X-Github-Event"][0] {
+	event := c.Get("X-Github-Event")
+	if event == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "missing X-Github-Event header")
+	}
+	switch event {
+	case "push", "ping":
+		Metrics.WebhookDeliveries.WithLabelValues(event).Inc()
+	default: // Labelled by what's handled only, so senders can't create series at will
+		Metrics.WebhookDeliveries.WithLabelValues("other").Inc()
+	}
+	switch event {
 	case "push":
 		if err := c.BodyParser(&Callback); err != nil {
-			panic(err)
+			return fiber.NewError(fiber.StatusBadRequest, "malformed push event: "+err.Error())
 		}
 		go constructAnnotationGrafana(Callback)
-		Processing.Index.Index = Processing.GenerateObjectIndex(config.Configuration.Blocklists)
+		// Git sources following the pushed ref index exactly what was pushed, once their repository has it. Unless the
+		// webhook was signed, anybody could pick the commit.
+		push := Processing.Push{
+			Remotes: []string{Callback.Repository.CloneUrl, Callback.Repository.SshUrl},
+			Ref:     Callback.Ref,
+			Commit:  Callback.After,
+		}
+		if len(HMACKey) == 0 {
+			log.Debugf("Not pinning git sources to %s of %s, GITHUB_WEBHOOK_SECRET is unset", Callback.After, Callback.Ref)
+		} else if pinned, err := Processing.PinPush(config.Current().BlocklistLocations(), push); err != nil {
+			log.Warnf("Push to %s can't be pinned, git sources read what their ref points to: %s", Callback.Ref, err.Error())
+		} else if pinned > 0 {
+			log.Infof("Pinned %d git sources to %s of %s", pinned, Callback.After, Callback.Ref)
+		}
+		Processing.Index.Rebuild(config.Current().BlocklistLocations())
 	case "ping": // Needs no processing
 	default:
 		return c.SendStatus(fiber.StatusNotImplemented)
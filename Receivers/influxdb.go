@@ -2,37 +2,105 @@ package Receivers
 
 import (
 	"AGB-BlocklistSrv/Processing"
-	"context"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/google/uuid"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api"
+	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
-var (
-	client = GetInstance()
-)
+// InfluxdbOptions controls how points are batched before they are written.
+type InfluxdbOptions struct {
+	BatchSize     uint
+	FlushInterval time.Duration
+}
+
+// Influxdb writes misses asynchronously in batches. It holds a client for its whole lifetime, Close flushes
+// whatever is still pending.
+type Influxdb struct {
+	client   influxdb2.Client
+	writeAPI api.WriteAPI
+	onError  atomic.Pointer[func(error)]
+	onWrite  atomic.Pointer[func(time.Duration)]
+	done     chan struct{}
+}
+
+func NewInfluxdb(options InfluxdbOptions) *Influxdb {
+	clientOptions := influxdb2.DefaultOptions().
+		SetBatchSize(options.BatchSize).
+		SetFlushInterval(uint(options.FlushInterval.Milliseconds()))
+	influx := &Influxdb{done: make(chan struct{})}
+	// Batches are written in the background, timing the requests is the only way to tell how long writes take
+	httpClient := clientOptions.HTTPClient()
+	httpClient.Transport = timedTransport{next: httpClient.Transport, onWrite: &influx.onWrite}
+	influx.client = influxdb2.NewClientWithOptions(os.Getenv("INFLUXDB_LOCATION"), os.Getenv("DOCKER_INFLUXDB_INIT_ADMIN_TOKEN"),
+		clientOptions.SetHTTPClient(httpClient))
+	influx.writeAPI = influx.client.WriteAPI(os.Getenv("DOCKER_INFLUXDB_INIT_ORG"), os.Getenv("DOCKER_INFLUXDB_INIT_BUCKET"))
+
+	// Errors has to be drained or write errors are skipped, it's closed once the client is
+	writeErrors := influx.writeAPI.Errors()
+	go func() {
+		defer close(influx.done)
+		for err := range writeErrors {
+			if onError := influx.onError.Load(); onError != nil {
+				(*onError)(err)
+			}
+		}
+	}()
+	return influx
+}
+
+// SetErrorCallback sets what is called for every batch that failed to write.
+func (influx *Influxdb) SetErrorCallback(onError func(error)) {
+	influx.onError.Store(&onError)
+}
+
+// SetWriteCallback sets what is called with how long every batch took to write, whether it failed or not.
+func (influx *Influxdb) SetWriteCallback(onWrite func(took time.Duration)) {
+	influx.onWrite.Store(&onWrite)
+}
+
+// timedTransport reports how long write requests take.
+type timedTransport struct {
+	next    http.RoundTripper
+	onWrite *atomic.Pointer[func(time.Duration)]
+}
 
-type Influxdb struct{}
+func (transport timedTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	started := time.Now()
+	resp, err := transport.next.RoundTrip(request)
+	if onWrite := transport.onWrite.Load(); onWrite != nil && strings.HasSuffix(request.URL.Path, "/api/v2/write") {
+		(*onWrite)(time.Since(started))
+	}
+	return resp, err
+}
 
-func (influx Influxdb) SendToRemote(misses []Processing.Gameobject, world *Processing.WorldObject) {
-	now := time.Now()
+func (influx *Influxdb) SendToRemote(report Processing.MissReport) error {
 	callbackSetId, err := uuid.NewUUID()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	for i, miss := range misses {
+	for i, miss := range report.Misses {
 		p := influxdb2.NewPointWithMeasurement("callbacks").
 			AddTag("callbackSetId", callbackSetId.String()).
-			AddTag("blocklists", *miss.ParentBlocklist).
+			AddTag("blocklists", miss.ParentBlocklist.Title).
 			AddTag("uniq", strconv.Itoa(i)).
 			AddField("objectName", miss.Name).
-			AddField("world", world.FriendlyName).
-			SetTime(now)
+			AddField("world", report.World.FriendlyName).
+			AddField("suppressed", int64(miss.Suppressed)).
+			AddField("reporters", miss.Reporters).
+			SetTime(report.ReceivedAt)
+		if miss.ParentBlocklist.Maintainer != "" {
+			p.AddField("blocklistMaintainer", miss.ParentBlocklist.Maintainer)
+		}
+		if miss.ParentBlocklist.Revision != "" {
+			p.AddField("blocklistRevision", miss.ParentBlocklist.Revision)
+		}
 		if miss.Position != nil {
 			p.AddField("position", miss.Position)
 		}
@@ -43,15 +111,15 @@ func (influx Influxdb) SendToRemote(misses []Processing.Gameobject, world *Proce
 			}
 		}
 
-		err = client.WritePoint(context.Background(), p)
-		if err != nil {
-			log.Error(err)
-		}
+		influx.writeAPI.WritePoint(p)
 	}
+	return nil
 }
 
-func GetInstance() api.WriteAPIBlocking {
-	influxClient := influxdb2.NewClient(os.Getenv("INFLUXDB_LOCATION"), os.Getenv("DOCKER_INFLUXDB_INIT_ADMIN_TOKEN"))
-	defer influxClient.Close()
-	return influxClient.WriteAPIBlocking(os.Getenv("DOCKER_INFLUXDB_INIT_ORG"), os.Getenv("DOCKER_INFLUXDB_INIT_BUCKET"))
+// Close flushes pending points and releases the client.
+func (influx *Influxdb) Close() error {
+	influx.writeAPI.Flush()
+	influx.client.Close()
+	<-influx.done
+	return nil
 }
@@ -0,0 +1,44 @@
+package Receivers
+
+import (
+	"AGB-BlocklistSrv/Processing"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInfluxdb_TimesBatchWrites(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	t.Setenv("INFLUXDB_LOCATION", server.URL)
+
+	var mutex sync.Mutex
+	var writes []time.Duration
+	influx := NewInfluxdb(InfluxdbOptions{BatchSize: 100, FlushInterval: time.Hour})
+	influx.SetWriteCallback(func(took time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		writes = append(writes, took)
+	})
+	blocklist := &Processing.BlocklistInfo{Title: "AGBTest"}
+	report := Processing.MissReport{World: &Processing.WorldObject{FriendlyName: "Test"}, ReceivedAt: time.Now(), Misses: []Processing.Miss{
+		{Gameobject: Processing.Gameobject{Name: "Poster", ParentBlocklist: blocklist}},
+		{Gameobject: Processing.Gameobject{Name: "Cube", ParentBlocklist: blocklist}},
+	}}
+	sendStarted := time.Now()
+	assert.NoError(t, influx.SendToRemote(report))
+	assert.Less(t, time.Since(sendStarted), 20*time.Millisecond, "points should only be queued")
+	influx.Close()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if assert.Len(t, writes, 1, "both points should be written as one batch") {
+		assert.GreaterOrEqual(t, writes[0], 20*time.Millisecond, "the write itself should be timed")
+	}
+}
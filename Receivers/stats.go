@@ -0,0 +1,177 @@
+package Receivers
+
+import (
+	"AGB-BlocklistSrv/Processing"
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MissStatistics is the statistics receiver. It outlives reloads, so switching other receivers around doesn't
+// throw away what was counted so far.
+var MissStatistics = NewStatistics(7 * 24 * time.Hour)
+
+// Statistics counts misses in memory in hourly buckets, so small deployments can answer which entries are missed
+// most without a time series database.
+type Statistics struct {
+	mutex     sync.Mutex
+	retention time.Duration
+	// buckets maps the start of every hour to what was counted during it
+	buckets map[time.Time]map[statisticsKey]*statisticsCount
+}
+
+type statisticsKey struct {
+	blocklist, world, object string
+}
+
+type statisticsCount struct {
+	worldName, objectName, maintainer string
+	misses, suppressed                uint64
+}
+
+// StatisticsQuery selects what Query counts. Empty filters match everything.
+type StatisticsQuery struct {
+	Since     time.Time
+	Blocklist string
+	// World matches either the hashed world ID or its friendly name.
+	World string
+	// By is "object" to count every object on its own or "world" to sum up all objects of a world.
+	By string
+	// Top limits the result to the most missed entries, 0 returns all of them.
+	Top int
+}
+
+// StatisticsEntry is how often an object, or all objects of a world, were missed.
+type StatisticsEntry struct {
+	Blocklist string
+	// Maintainer is who maintains Blocklist according to the misses counted for it.
+	Maintainer string `json:",omitempty"`
+	WorldId    string
+	World      string
+	// ObjectHash and Object are left empty when counting by world.
+	ObjectHash string `json:",omitempty"`
+	Object     string `json:",omitempty"`
+	Misses     uint64
+	// Suppressed counts duplicate reports that were held back on top of Misses.
+	Suppressed uint64
+}
+
+func NewStatistics(retention time.Duration) *Statistics {
+	return &Statistics{
+		retention: retention,
+		buckets:   make(map[time.Time]map[statisticsKey]*statisticsCount),
+	}
+}
+
+// SetRetention sets how long misses are counted for. Buckets that fall out of it are dropped on the next write.
+func (statistics *Statistics) SetRetention(retention time.Duration) {
+	statistics.mutex.Lock()
+	defer statistics.mutex.Unlock()
+	statistics.retention = retention
+}
+
+// Retention returns how long misses are counted for.
+func (statistics *Statistics) Retention() time.Duration {
+	statistics.mutex.Lock()
+	defer statistics.mutex.Unlock()
+	return statistics.retention
+}
+
+func (statistics *Statistics) SendToRemote(report Processing.MissReport) error {
+	statistics.mutex.Lock()
+	defer statistics.mutex.Unlock()
+
+	hour := report.ReceivedAt.UTC().Truncate(time.Hour)
+	statistics.expire(report.ReceivedAt)
+	bucket, exists := statistics.buckets[hour]
+	if !exists {
+		bucket = make(map[statisticsKey]*statisticsCount)
+		statistics.buckets[hour] = bucket
+	}
+
+	for _, miss := range report.Misses {
+		var blocklist, maintainer string
+		if miss.ParentBlocklist != nil {
+			blocklist, maintainer = miss.ParentBlocklist.Title, miss.ParentBlocklist.Maintainer
+		}
+		key := statisticsKey{blocklist: blocklist, world: report.WorldId, object: miss.Hash}
+		count, exists := bucket[key]
+		if !exists {
+			count = &statisticsCount{worldName: report.World.FriendlyName, objectName: miss.Name}
+			bucket[key] = count
+		}
+		count.maintainer = maintainer
+		count.misses++
+		count.suppressed += miss.Suppressed
+	}
+	return nil
+}
+
+// expire drops every bucket that lies entirely outside of the retention as of now.
+func (statistics *Statistics) expire(now time.Time) {
+	oldest := now.Add(-statistics.retention).UTC().Truncate(time.Hour)
+	for hour := range statistics.buckets {
+		if hour.Before(oldest) {
+			delete(statistics.buckets, hour)
+		}
+	}
+}
+
+// Query sums up the misses matching query, most missed first. Counting is per hour, so the hour query.Since lies
+// in is counted as a whole.
+func (statistics *Statistics) Query(query StatisticsQuery) []StatisticsEntry {
+	statistics.mutex.Lock()
+	defer statistics.mutex.Unlock()
+
+	since := query.Since.UTC().Truncate(time.Hour)
+	entries := make(map[statisticsKey]*StatisticsEntry)
+	for hour, bucket := range statistics.buckets {
+		if hour.Before(since) {
+			continue
+		}
+		for key, count := range bucket {
+			if query.Blocklist != "" && key.blocklist != query.Blocklist {
+				continue
+			}
+			if query.World != "" && key.world != query.World && count.worldName != query.World {
+				continue
+			}
+
+			entryKey := key
+			if query.By == "world" {
+				entryKey.object = ""
+			}
+			entry, exists := entries[entryKey]
+			if !exists {
+				entry = &StatisticsEntry{Blocklist: key.blocklist, WorldId: key.world, World: count.worldName}
+				if query.By != "world" {
+					entry.ObjectHash, entry.Object = key.object, count.objectName
+				}
+				entries[entryKey] = entry
+			}
+			entry.Maintainer = cmp.Or(entry.Maintainer, count.maintainer)
+			entry.Misses += count.misses
+			entry.Suppressed += count.suppressed
+		}
+	}
+
+	result := make([]StatisticsEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, *entry)
+	}
+	slices.SortFunc(result, func(a, b StatisticsEntry) int {
+		return cmp.Or(
+			cmp.Compare(b.Misses, a.Misses),
+			cmp.Compare(a.Blocklist, b.Blocklist),
+			cmp.Compare(a.World, b.World),
+			cmp.Compare(a.WorldId, b.WorldId),
+			cmp.Compare(a.Object, b.Object),
+			cmp.Compare(a.ObjectHash, b.ObjectHash),
+		)
+	})
+	if query.Top > 0 && len(result) > query.Top {
+		result = result[:query.Top]
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+package Receivers
+
+import (
+	"AGB-BlocklistSrv/Processing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestStatistics(t *testing.T) {
+	now := time.Date(2024, 6, 8, 12, 30, 0, 0, time.UTC)
+	upsell, base := "AGBUpsell", "AGBBase"
+	maintainers := map[string]string{base: "AdGoBye"}
+	miss := func(name, blocklist string, suppressed uint64) Processing.Miss {
+		return Processing.Miss{
+			Gameobject: Processing.Gameobject{Name: name, ParentBlocklist: &Processing.BlocklistInfo{Title: blocklist, Maintainer: maintainers[blocklist]}},
+			Hash:       name + "-hash",
+			Suppressed: suppressed,
+		}
+	}
+	statistics := NewStatistics(7 * 24 * time.Hour)
+	send := func(world string, at time.Time, misses ...Processing.Miss) {
+		assert.NoError(t, statistics.SendToRemote(Processing.MissReport{
+			World:      &Processing.WorldObject{FriendlyName: world},
+			WorldId:    world + "-hash",
+			Misses:     misses,
+			ReceivedAt: at,
+		}))
+	}
+	send("Just B Club 3", now.Add(-8*24*time.Hour), miss("Discord TV Ad (1)", upsell, 0)) // Expired on the next write
+	send("Just B Club 3", now.Add(-2*24*time.Hour), miss("Discord TV Ad (1)", upsell, 2), miss("Poster (9)", upsell, 0))
+	send("Just B Club 3", now.Add(-time.Hour), miss("Discord TV Ad (1)", upsell, 0))
+	send("Movie & Chill", now, miss("Label (2)", base, 0))
+
+	tests := []struct {
+		name  string
+		query StatisticsQuery
+		want  []StatisticsEntry
+	}{
+		{
+			name:  "top object this week",
+			query: StatisticsQuery{Since: now.Add(-7 * 24 * time.Hour), By: "object", Top: 1},
+			want: []StatisticsEntry{{Blocklist: upsell, WorldId: "Just B Club 3-hash", World: "Just B Club 3",
+				ObjectHash: "Discord TV Ad (1)-hash", Object: "Discord TV Ad (1)", Misses: 2, Suppressed: 2}},
+		},
+		{
+			name:  "by world within a day",
+			query: StatisticsQuery{Since: now.Add(-24 * time.Hour), By: "world"},
+			want: []StatisticsEntry{
+				{Blocklist: base, Maintainer: "AdGoBye", WorldId: "Movie & Chill-hash", World: "Movie & Chill", Misses: 1},
+				{Blocklist: upsell, WorldId: "Just B Club 3-hash", World: "Just B Club 3", Misses: 1},
+			},
+		},
+		{
+			name:  "filtered by blocklist and world name",
+			query: StatisticsQuery{Since: now.Add(-7 * 24 * time.Hour), Blocklist: upsell, World: "Just B Club 3", By: "world"},
+			want:  []StatisticsEntry{{Blocklist: upsell, WorldId: "Just B Club 3-hash", World: "Just B Club 3", Misses: 3, Suppressed: 2}},
+		},
+		{
+			name:  "filtered by world hash",
+			query: StatisticsQuery{Since: now.Add(-7 * 24 * time.Hour), World: "Movie & Chill-hash", By: "object"},
+			want: []StatisticsEntry{{Blocklist: base, Maintainer: "AdGoBye", WorldId: "Movie & Chill-hash", World: "Movie & Chill",
+				ObjectHash: "Label (2)-hash", Object: "Label (2)", Misses: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, statistics.Query(tt.query))
+		})
+	}
+}
@@ -7,9 +7,11 @@ import (
 
 type Stub struct{}
 
-func (stub Stub) SendToRemote(misses []Processing.Gameobject, world *Processing.WorldObject) {
-	fmt.Println("Received hit for " + world.FriendlyName + ":")
-	for _, miss := range misses {
-		fmt.Printf("%v", miss)
+func (stub Stub) SendToRemote(report Processing.MissReport) error {
+	fmt.Println("Received hit for " + report.World.FriendlyName + ":")
+	for _, miss := range report.Misses {
+		fmt.Printf("  %s (%s) from %s, maintained by %q at revision %s\n", miss.Name, miss.Hash,
+			miss.ParentBlocklist.Title, miss.ParentBlocklist.Maintainer, miss.ParentBlocklist.Revision)
 	}
+	return nil
 }
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"AGB-BlocklistSrv/Processing"
+	"AGB-BlocklistSrv/config"
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// adminToken guards the /admin and monitoring endpoints, which stay disabled while it is unset.
+var adminToken = []byte(os.Getenv("BLOCKLISTSRV_ADMIN_TOKEN"))
+
+// requireAdminToken lets requests through that carry adminToken as bearer token.
+func requireAdminToken(c *fiber.Ctx) error {
+	if len(adminToken) == 0 {
+		return Processing.NewProblem(fiber.StatusForbidden, "admin endpoints are disabled, set BLOCKLISTSRV_ADMIN_TOKEN to enable them")
+	}
+	token, found := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !found || subtle.ConstantTimeCompare([]byte(token), adminToken) != 1 {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="blocklistsrv"`)
+		return Processing.NewProblem(fiber.StatusUnauthorized, "missing or wrong bearer token")
+	}
+	return c.Next()
+}
+
+// indexInfo is what GET /admin/index answers with.
+type indexInfo struct {
+	Generation uint64
+	BuiltAt    time.Time
+	Sources    []string
+	Results    []Processing.SourceResult
+	Blocklists []*Processing.BlocklistInfo
+	Worlds     int
+	Objects    int
+}
+
+func describeIndex(c *fiber.Ctx) error {
+	snapshot := Processing.Index.Snapshot()
+	info := indexInfo{
+		Generation: snapshot.Generation,
+		BuiltAt:    snapshot.BuiltAt,
+		Sources:    snapshot.Sources,
+		Results:    snapshot.Results,
+		Blocklists: snapshot.Blocklists,
+		Worlds:     len(snapshot.Index),
+	}
+	for _, world := range snapshot.Index {
+		info.Objects += len(world.GameObjectMapping)
+	}
+	return c.JSON(info)
+}
+
+func listWorlds(c *fiber.Ctx) error {
+	return c.JSON(Processing.Index.Snapshot().Worlds())
+}
+
+// listWorldObjects lists the objects of the world named in the path, either by the hash clients send or by its
+// plain wrld_ ID.
+func listWorldObjects(c *fiber.Ctx) error {
+	worldId, err := url.PathUnescape(c.Params("*"))
+	if err != nil {
+		return Processing.NewProblem(fiber.StatusBadRequest, "malformed world: "+err.Error())
+	}
+	if strings.HasPrefix(worldId, "wrld_") {
+		worldId = Processing.HashWorldId(worldId)
+	}
+	objects, ok := Processing.Index.Snapshot().Objects(worldId)
+	if !ok {
+		return Processing.NewProblem(fiber.StatusNotFound, "no world "+worldId+" in the index")
+	}
+	return c.JSON(objects)
+}
+
+// searchObjects finds objects by name, taking name and limit (defaults to 100, 0 for all).
+func searchObjects(c *fiber.Ctx) error {
+	name := c.Query("name")
+	if name == "" {
+		problem := Processing.NewProblem(fiber.StatusBadRequest, "invalid object search")
+		problem.InvalidParams = []Processing.InvalidParam{{Name: "name", Reason: "missing"}}
+		return problem
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "100"))
+	if err != nil || limit < 0 {
+		problem := Processing.NewProblem(fiber.StatusBadRequest, "invalid object search")
+		problem.InvalidParams = []Processing.InvalidParam{{Name: "limit", Reason: "not a number of at least 0"}}
+		return problem
+	}
+	return c.JSON(Processing.Index.Snapshot().SearchObjects(name, limit))
+}
+
+// reindexRequest is what POST /admin/reindex takes, an empty body refreshes every source.
+type reindexRequest struct {
+	// Sources lists the configured sources to fetch again, the others keep what they parsed to last time.
+	Sources []string
+}
+
+// reindexResponse is what POST /admin/reindex answers with.
+type reindexResponse struct {
+	Generation uint64
+	BuiltAt    time.Time
+	Results    []Processing.SourceResult
+}
+
+// reindex rebuilds the index right away, regardless of whether the pusher is able to.
+func reindex(c *fiber.Ctx) error {
+	var request reindexRequest
+	if len(c.Body()) > 0 {
+		if err := json.Unmarshal(c.Body(), &request); err != nil {
+			return Processing.NewProblem(fiber.StatusBadRequest, "malformed reindex request: "+err.Error())
+		}
+	}
+
+	sources := config.Current().BlocklistLocations()
+	var invalid []Processing.InvalidParam
+	for i, source := range request.Sources {
+		if !slices.Contains(sources, source) {
+			invalid = append(invalid, Processing.InvalidParam{Name: "Sources[" + strconv.Itoa(i) + "]", Reason: "not a configured blocklist"})
+		}
+	}
+	if len(invalid) > 0 {
+		problem := Processing.NewProblem(fiber.StatusUnprocessableEntity, "invalid reindex request")
+		problem.InvalidParams = invalid
+		return problem
+	}
+
+	var snapshot *Processing.WorldObjectIndex
+	if len(request.Sources) == 0 {
+		snapshot = Processing.Index.Rebuild(sources)
+	} else {
+		snapshot = Processing.Index.Refresh(sources, request.Sources)
+	}
+	log.Infof("Reindexed %d blocks as generation %d on request", len(snapshot.Index), snapshot.Generation)
+	return c.JSON(reindexResponse{Generation: snapshot.Generation, BuiltAt: snapshot.BuiltAt, Results: snapshot.Results})
+}
+
+func sourceStatuses(c *fiber.Ctx) error {
+	return c.JSON(Processing.SourceStatuses(config.Current().BlocklistLocations()))
+}
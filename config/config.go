@@ -2,27 +2,476 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2/log"
+	"net/netip"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// DefaultPath is used when neither the -config flag nor BLOCKLISTSRV_CONFIG point somewhere else.
+const DefaultPath = "config.json"
+
+const DefaultCacheDirectory = "cache"
+
 var (
-	Configuration = loadConfiguration()
+	configuration atomic.Pointer[SrvConfiguration]
+	path          string
+
+	reloadMutex sync.Mutex
+	validators  []func(SrvConfiguration) error
+	listeners   []func(previous, current SrvConfiguration)
 )
 
 type SrvConfiguration struct {
-	Blocklists []string `json:"Blocklists"`
-	Reciever   string   `json:"Reciever"`
-	Pusher     string   `json:"Pusher"`
+	Blocklists []BlocklistSource    `json:"Blocklists"`
+	Refresh    RefreshConfiguration `json:"Refresh"`
+	// Reciever is the single receiver older configurations name, Receivers takes precedence if set.
+	Reciever  string   `json:"Reciever"`
+	Receivers []string `json:"Receivers"`
+	// ReceiverQueueSize is how many reports each receiver can fall behind before it starts dropping them.
+	ReceiverQueueSize int    `json:"ReceiverQueueSize"`
+	Pusher            string `json:"Pusher"`
+	// DeniedClientVersions lists client versions with known reporting bugs, their callbacks are refused.
+	DeniedClientVersions []string `json:"DeniedClientVersions"`
+	// MaxUnmatchedObjects is how many objects a single callback may report before it is rejected.
+	MaxUnmatchedObjects int `json:"MaxUnmatchedObjects"`
+	// TrustedProxies lists addresses or CIDR ranges whose X-Forwarded-For header is believed when telling clients apart.
+	TrustedProxies []string               `json:"TrustedProxies"`
+	RateLimit      RateLimitConfiguration `json:"RateLimit"`
+	// ReporterIdentity is how reporters are told apart: "address" (the default) or "installid", which falls back
+	// to the address for callbacks without an install ID.
+	ReporterIdentity string              `json:"ReporterIdentity"`
+	Dedup            DedupConfiguration  `json:"Dedup"`
+	Quorum           QuorumConfiguration `json:"Quorum"`
+	// CacheDirectory keeps the last known good copy of every blocklist, defaults to DefaultCacheDirectory.
+	CacheDirectory string                `json:"CacheDirectory"`
+	Fetch          FetchConfiguration    `json:"Fetch"`
+	Ingest         IngestConfiguration   `json:"Ingest"`
+	Influxdb       InfluxdbConfiguration `json:"Influxdb"`
+	Stats          StatsConfiguration    `json:"Stats"`
+	// Listen is where callbacks are accepted. Admin endpoints are served there too unless AdminListen is set.
+	Listen      ListenerConfiguration  `json:"Listen"`
+	AdminListen *ListenerConfiguration `json:"AdminListen"`
+	// ShutdownTimeout bounds how long in-flight callbacks and receivers get to finish on SIGTERM/SIGINT.
+	ShutdownTimeout Duration `json:"ShutdownTimeout"`
+}
+
+// ListenerConfiguration describes a socket to serve HTTP on.
+type ListenerConfiguration struct {
+	// Network is "tcp" (the default), "tcp4", "tcp6" or "unix", in which case Address is the socket path.
+	Network string `json:"Network"`
+	Address string `json:"Address"`
+	// TLSCertificate and TLSKey enable TLS, they are re-read when they change on disk.
+	TLSCertificate string `json:"TLSCertificate"`
+	TLSKey         string `json:"TLSKey"`
+}
+
+// RefreshConfiguration controls how often blocklists are refreshed unless a source says otherwise.
+type RefreshConfiguration struct {
+	Interval Duration `json:"Interval"`
+	// Jitter delays every refresh by a random duration up to it, so sources don't all hit the same server at once.
+	Jitter Duration `json:"Jitter"`
+	// MaxBackoff caps how far a failing source's refreshes are spread out, they double with every failure in a row.
+	MaxBackoff Duration `json:"MaxBackoff"`
+}
+
+// RateLimitConfiguration throttles callbacks per client address and per world.
+type RateLimitConfiguration struct {
+	PerClient Rate `json:"PerClient"`
+	PerWorld  Rate `json:"PerWorld"`
+	// MaxTracked bounds how many clients and worlds are remembered each, so a flood of addresses can't exhaust memory.
+	MaxTracked int `json:"MaxTracked"`
+	// Allowlist lists addresses or CIDR ranges that are never limited.
+	Allowlist []string `json:"Allowlist"`
+}
+
+// DedupConfiguration controls holding back misses a reporter already reported recently.
+type DedupConfiguration struct {
+	// Window is how long identical reports from the same reporter are held back, 0 disables deduplication.
+	Window Duration `json:"Window"`
+	// MaxEntries bounds how many reported misses are remembered.
+	MaxEntries int `json:"MaxEntries"`
+}
+
+// QuorumConfiguration controls holding back misses until enough distinct reporters reported them.
+type QuorumConfiguration struct {
+	// Reporters is how many distinct reporters have to report a miss within Window, 0 or 1 disables quorum.
+	Reporters int      `json:"Reporters"`
+	Window    Duration `json:"Window"`
+	// MaxEntries bounds how many reported misses are remembered.
+	MaxEntries int `json:"MaxEntries"`
+}
+
+// Rate is a token bucket, a PerSecond of 0 disables it.
+type Rate struct {
+	PerSecond float64 `json:"PerSecond"`
+	// Burst is how many requests may be made at once before PerSecond kicks in.
+	Burst int `json:"Burst"`
 }
 
-func loadConfiguration() (config SrvConfiguration) {
-	configBytes, err := os.ReadFile("config.json")
+// InfluxdbConfiguration controls how the influxdb receiver batches its writes.
+type InfluxdbConfiguration struct {
+	BatchSize     uint     `json:"BatchSize"`
+	FlushInterval Duration `json:"FlushInterval"`
+}
+
+// StatsConfiguration controls the in-memory statistics receiver.
+type StatsConfiguration struct {
+	// Retention is how long misses are counted for, the longest window /v1/stats can answer for.
+	Retention Duration `json:"Retention"`
+}
+
+// IngestConfiguration controls the queue between accepting callbacks and matching them against the index.
+type IngestConfiguration struct {
+	Workers   int `json:"Workers"`
+	QueueSize int `json:"QueueSize"`
+	// RetryAfter is what clients are told to wait when the queue is full.
+	RetryAfter Duration `json:"RetryAfter"`
+}
+
+// FetchConfiguration controls how blocklists are downloaded over HTTP.
+type FetchConfiguration struct {
+	Timeout Duration `json:"Timeout"`
+	// Retries is how often a failed download is retried, waiting RetryBackoff doubled per attempt in between.
+	Retries      int      `json:"Retries"`
+	RetryBackoff Duration `json:"RetryBackoff"`
+	MaxBodyBytes int64    `json:"MaxBodyBytes"`
+}
+
+// PathFromEnvironment returns the configuration path set through BLOCKLISTSRV_CONFIG, falling back to DefaultPath.
+func PathFromEnvironment() string {
+	if envPath, ok := os.LookupEnv("BLOCKLISTSRV_CONFIG"); ok && envPath != "" {
+		return envPath
+	}
+	return DefaultPath
+}
+
+// Init loads the configuration at configPath and makes it the running configuration.
+// Unlike Reload, there is no running configuration to fall back to, so callers should treat errors as fatal.
+func Init(configPath string) error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	loaded, err := Load(configPath)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	path = configPath
+	configuration.Store(&loaded)
+	return nil
+}
+
+// Current returns the running configuration. Init must have been called before.
+func Current() SrvConfiguration {
+	return *configuration.Load()
+}
+
+// AddValidator registers an additional check a configuration has to pass before it is accepted.
+// This is for validation that needs knowledge outside of this package, like which receivers exist.
+func AddValidator(validator func(SrvConfiguration) error) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	validators = append(validators, validator)
+}
+
+// OnReload registers a listener that is called after a new configuration has been accepted.
+func OnReload(listener func(previous, current SrvConfiguration)) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	listeners = append(listeners, listener)
+}
+
+// Load reads and validates the configuration at configPath without applying it.
+func Load(configPath string) (config SrvConfiguration, err error) {
+	configBytes, err := os.ReadFile(configPath)
+	if err != nil {
+		return SrvConfiguration{}, err
 	}
 	err = json.Unmarshal(configBytes, &config)
 	if err != nil {
-		panic(err)
+		return SrvConfiguration{}, err
+	}
+	config.applyDefaults()
+	if err = config.validate(); err != nil {
+		return SrvConfiguration{}, err
+	}
+	for _, validator := range validators {
+		if err = validator(config); err != nil {
+			return SrvConfiguration{}, err
+		}
+	}
+	return config, nil
+}
+
+// Reload re-reads the configuration file. If the new configuration is invalid, the running one is kept and the
+// reason is returned.
+func Reload() error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	loaded, err := Load(path)
+	if err != nil {
+		return err
+	}
+	previous := configuration.Swap(&loaded)
+	for _, listener := range listeners {
+		listener(*previous, loaded)
+	}
+	return nil
+}
+
+// Watch reloads the configuration whenever the file changes on disk or a signal arrives on hangup, which callers
+// should set up with signal.Notify for SIGHUP as early as possible. It blocks until stop is closed.
+func Watch(pollInterval time.Duration, hangup <-chan os.Signal, stop <-chan struct{}) {
+	lastModified, lastSize := statConfiguration()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hangup:
+			log.Infof("Received SIGHUP, reloading configuration from %s", path)
+			lastModified, lastSize = statConfiguration()
+		case <-ticker.C:
+			modified, size := statConfiguration()
+			// Editors tend to truncate before writing, give them a tick to finish instead of rejecting an empty file
+			if size == 0 || (modified.Equal(lastModified) && size == lastSize) {
+				continue
+			}
+			lastModified, lastSize = modified, size
+			log.Infof("Configuration file %s changed, reloading", path)
+		}
+
+		if err := Reload(); err != nil {
+			log.Errorf("Rejected new configuration from %s, keeping the running one: %s", path, err.Error())
+			continue
+		}
+		log.Infof("Applied new configuration from %s", path)
+	}
+}
+
+func statConfiguration() (time.Time, int64) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return info.ModTime(), info.Size()
+}
+
+// ReceiverNames returns every receiver misses should be sent to.
+func (config SrvConfiguration) ReceiverNames() []string {
+	if len(config.Receivers) > 0 {
+		return config.Receivers
+	}
+	if config.Reciever != "" {
+		return []string{config.Reciever}
+	}
+	return nil
+}
+
+// BlocklistLocations returns the location of every blocklist.
+func (config SrvConfiguration) BlocklistLocations() []string {
+	locations := make([]string, 0, len(config.Blocklists))
+	for _, source := range config.Blocklists {
+		locations = append(locations, source.Location)
+	}
+	return locations
+}
+
+func (config *SrvConfiguration) applyDefaults() {
+	if config.Refresh.Interval.Duration == 0 {
+		config.Refresh.Interval.Duration = time.Hour
+	}
+	if config.Refresh.MaxBackoff.Duration == 0 {
+		config.Refresh.MaxBackoff.Duration = 24 * time.Hour
+	}
+	if config.ReceiverQueueSize == 0 {
+		config.ReceiverQueueSize = 1024
+	}
+	if config.CacheDirectory == "" {
+		config.CacheDirectory = DefaultCacheDirectory
+	}
+	if config.MaxUnmatchedObjects == 0 {
+		config.MaxUnmatchedObjects = 1024
+	}
+	if config.RateLimit.MaxTracked == 0 {
+		config.RateLimit.MaxTracked = 65536
+	}
+	if config.Dedup.MaxEntries == 0 {
+		config.Dedup.MaxEntries = 100000
+	}
+	if config.ReporterIdentity == "" {
+		config.ReporterIdentity = "address"
+	}
+	if config.Quorum.Window.Duration == 0 {
+		config.Quorum.Window.Duration = 24 * time.Hour
+	}
+	if config.Quorum.MaxEntries == 0 {
+		config.Quorum.MaxEntries = 100000
+	}
+	if config.Ingest.Workers == 0 {
+		config.Ingest.Workers = 4
+	}
+	if config.Ingest.QueueSize == 0 {
+		config.Ingest.QueueSize = 4096
+	}
+	if config.Ingest.RetryAfter.Duration == 0 {
+		config.Ingest.RetryAfter.Duration = 5 * time.Second
+	}
+	if config.Listen.Network == "" {
+		config.Listen.Network = "tcp"
+	}
+	if config.Listen.Address == "" {
+		config.Listen.Address = ":80"
+	}
+	if config.AdminListen != nil && config.AdminListen.Network == "" {
+		config.AdminListen.Network = "tcp"
+	}
+	if config.ShutdownTimeout.Duration == 0 {
+		config.ShutdownTimeout.Duration = 30 * time.Second
+	}
+	if config.Influxdb.BatchSize == 0 {
+		config.Influxdb.BatchSize = 500
+	}
+	if config.Influxdb.FlushInterval.Duration == 0 {
+		config.Influxdb.FlushInterval.Duration = time.Second
+	}
+	if config.Stats.Retention.Duration == 0 {
+		config.Stats.Retention.Duration = 7 * 24 * time.Hour
+	}
+	if config.Fetch.Timeout.Duration == 0 {
+		config.Fetch.Timeout.Duration = 30 * time.Second
+	}
+	if config.Fetch.RetryBackoff.Duration == 0 {
+		config.Fetch.RetryBackoff.Duration = time.Second
+	}
+	if config.Fetch.MaxBodyBytes == 0 {
+		config.Fetch.MaxBodyBytes = 16 << 20
+	}
+}
+
+func (config SrvConfiguration) validate() error {
+	if len(config.Blocklists) == 0 {
+		return errors.New("no blocklists configured")
+	}
+	for _, source := range config.Blocklists {
+		if err := source.validate(); err != nil {
+			return err
+		}
+	}
+	if duplicate := firstDuplicate(config.BlocklistLocations()); duplicate != "" {
+		return errors.New("blocklist configured twice: " + duplicate)
+	}
+	if config.Refresh.Interval.Duration < 0 || config.Refresh.Jitter.Duration < 0 || config.Refresh.MaxBackoff.Duration < 0 {
+		return errors.New("refresh interval, jitter and backoff can't be negative")
+	}
+	if len(config.ReceiverNames()) == 0 {
+		return errors.New("no receivers configured")
+	}
+	if duplicate := firstDuplicate(config.ReceiverNames()); duplicate != "" {
+		return errors.New("receiver configured twice: " + duplicate)
+	}
+	if config.ReceiverQueueSize < 0 {
+		return errors.New("receiver queue size can't be negative")
+	}
+	if config.MaxUnmatchedObjects < 0 {
+		return errors.New("unmatched object limit can't be negative")
+	}
+	if _, err := ParsePrefixes(config.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid trusted proxy: %w", err)
+	}
+	if _, err := ParsePrefixes(config.RateLimit.Allowlist); err != nil {
+		return fmt.Errorf("invalid rate limit allowlist entry: %w", err)
+	}
+	if config.RateLimit.PerClient.PerSecond < 0 || config.RateLimit.PerWorld.PerSecond < 0 || config.RateLimit.MaxTracked < 0 {
+		return errors.New("rate limits can't be negative")
+	}
+	if config.Dedup.Window.Duration < 0 || config.Dedup.MaxEntries < 0 {
+		return errors.New("dedup window and entries can't be negative")
+	}
+	if config.ReporterIdentity != "address" && config.ReporterIdentity != "installid" {
+		return errors.New("unsupported reporter identity: " + config.ReporterIdentity)
+	}
+	if config.Quorum.Reporters < 0 || config.Quorum.Window.Duration < 0 || config.Quorum.MaxEntries < 0 {
+		return errors.New("quorum reporters, window and entries can't be negative")
+	}
+	if config.Ingest.Workers < 0 || config.Ingest.QueueSize < 0 || config.Ingest.RetryAfter.Duration < 0 {
+		return errors.New("ingest workers, queue size and retry delay can't be negative")
+	}
+	if err := config.Listen.validate(); err != nil {
+		return fmt.Errorf("invalid listener: %w", err)
+	}
+	if config.AdminListen != nil {
+		if err := config.AdminListen.validate(); err != nil {
+			return fmt.Errorf("invalid admin listener: %w", err)
+		}
+		if *config.AdminListen == config.Listen {
+			return errors.New("admin listener can't be the same as the public one")
+		}
+	}
+	if config.ShutdownTimeout.Duration < 0 {
+		return errors.New("shutdown timeout can't be negative")
+	}
+	if config.Influxdb.FlushInterval.Duration < 0 {
+		return errors.New("influxdb flush interval can't be negative")
+	}
+	if config.Stats.Retention.Duration < 0 {
+		return errors.New("stats retention can't be negative")
+	}
+	if config.Fetch.Retries < 0 || config.Fetch.Timeout.Duration < 0 || config.Fetch.RetryBackoff.Duration < 0 {
+		return errors.New("fetch timeout, retries and backoff can't be negative")
+	}
+	if config.Fetch.MaxBodyBytes < 0 {
+		return errors.New("fetch body limit can't be negative")
+	}
+	return nil
+}
+
+func (listener ListenerConfiguration) validate() error {
+	switch listener.Network {
+	case "tcp", "tcp4", "tcp6", "unix":
+	default:
+		return errors.New("unsupported network: " + listener.Network)
+	}
+	if listener.Address == "" {
+		return errors.New("no address")
+	}
+	if (listener.TLSCertificate == "") != (listener.TLSKey == "") {
+		return errors.New("TLS needs both a certificate and a key")
+	}
+	return nil
+}
+
+// ParsePrefixes parses addresses and CIDR ranges, a plain address is a range containing only itself.
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if addr, err := netip.ParseAddr(value); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func firstDuplicate(values []string) string {
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		if seen[value] {
+			return value
+		}
+		seen[value] = true
 	}
-	return config
+	return ""
 }
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    SrvConfiguration
+		wantErr bool
+	}{
+		{
+			name:    "valid configuration",
+			content: `{"Blocklists": ["file:///AGBBase.toml"], "Reciever": "stub", "Pusher": "grafghanno"}`,
+			want: SrvConfiguration{Blocklists: []BlocklistSource{{Location: "file:///AGBBase.toml"}}, Reciever: "stub", Pusher: "grafghanno",
+				ReceiverQueueSize: 1024, CacheDirectory: DefaultCacheDirectory, MaxUnmatchedObjects: 1024,
+				RateLimit:        RateLimitConfiguration{MaxTracked: 65536},
+				ReporterIdentity: "address", Dedup: DedupConfiguration{MaxEntries: 100000},
+				Quorum:          QuorumConfiguration{Window: Duration{24 * time.Hour}, MaxEntries: 100000},
+				Ingest:          IngestConfiguration{Workers: 4, QueueSize: 4096, RetryAfter: Duration{5 * time.Second}},
+				Influxdb:        InfluxdbConfiguration{BatchSize: 500, FlushInterval: Duration{time.Second}},
+				Stats:           StatsConfiguration{Retention: Duration{7 * 24 * time.Hour}},
+				Refresh:         RefreshConfiguration{Interval: Duration{time.Hour}, MaxBackoff: Duration{24 * time.Hour}},
+				Listen:          ListenerConfiguration{Network: "tcp", Address: ":80"},
+				ShutdownTimeout: Duration{30 * time.Second}, Fetch: FetchConfiguration{
+					Timeout: Duration{30 * time.Second}, RetryBackoff: Duration{time.Second}, MaxBodyBytes: 16 << 20,
+				}},
+		},
+		{
+			name: "fetch settings",
+			content: `{"Blocklists": ["file:///AGBBase.toml"], "Reciever": "stub", "CacheDirectory": "/var/cache/blocklistsrv",
+				"Fetch": {"Timeout": "5s", "Retries": 3, "RetryBackoff": "250ms", "MaxBodyBytes": 1024}}`,
+			want: SrvConfiguration{Blocklists: []BlocklistSource{{Location: "file:///AGBBase.toml"}}, Reciever: "stub",
+				ReceiverQueueSize: 1024, CacheDirectory: "/var/cache/blocklistsrv", MaxUnmatchedObjects: 1024,
+				RateLimit:        RateLimitConfiguration{MaxTracked: 65536},
+				ReporterIdentity: "address", Dedup: DedupConfiguration{MaxEntries: 100000},
+				Quorum:          QuorumConfiguration{Window: Duration{24 * time.Hour}, MaxEntries: 100000},
+				Ingest:          IngestConfiguration{Workers: 4, QueueSize: 4096, RetryAfter: Duration{5 * time.Second}},
+				Influxdb:        InfluxdbConfiguration{BatchSize: 500, FlushInterval: Duration{time.Second}},
+				Stats:           StatsConfiguration{Retention: Duration{7 * 24 * time.Hour}},
+				Refresh:         RefreshConfiguration{Interval: Duration{time.Hour}, MaxBackoff: Duration{24 * time.Hour}},
+				Listen:          ListenerConfiguration{Network: "tcp", Address: ":80"},
+				ShutdownTimeout: Duration{30 * time.Second}, Fetch: FetchConfiguration{
+					Timeout: Duration{5 * time.Second}, Retries: 3, RetryBackoff: Duration{250 * time.Millisecond}, MaxBodyBytes: 1024,
+				}},
+		},
+		{
+			name: "scheduled sources",
+			content: `{"Blocklists": ["file:///AGBBase.toml", {"Location": "file:///AGBUpsell.toml", "Cron": "0 */6 * * *"},
+				{"Location": "file:///AGBCommunity.toml", "Interval": "15m", "Jitter": "1m"},
+				{"Location": "https://example.com/generated", "Format": "json"},
+				{"Location": "https://example.com/signed.toml", "SHA256": "E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855",
+					"PublicKeys": ["RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3"]}], "Reciever": "stub"}`,
+			want: SrvConfiguration{Blocklists: []BlocklistSource{
+				{Location: "file:///AGBBase.toml"},
+				{Location: "file:///AGBUpsell.toml", Cron: "0 */6 * * *"},
+				{Location: "file:///AGBCommunity.toml", Interval: Duration{15 * time.Minute}, Jitter: Duration{time.Minute}},
+				{Location: "https://example.com/generated", Format: "json"},
+				{Location: "https://example.com/signed.toml", SHA256: "E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855",
+					PublicKeys: []string{"RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3"}},
+			}, Reciever: "stub",
+				ReceiverQueueSize: 1024, CacheDirectory: DefaultCacheDirectory, MaxUnmatchedObjects: 1024,
+				RateLimit:        RateLimitConfiguration{MaxTracked: 65536},
+				ReporterIdentity: "address", Dedup: DedupConfiguration{MaxEntries: 100000},
+				Quorum:          QuorumConfiguration{Window: Duration{24 * time.Hour}, MaxEntries: 100000},
+				Ingest:          IngestConfiguration{Workers: 4, QueueSize: 4096, RetryAfter: Duration{5 * time.Second}},
+				Influxdb:        InfluxdbConfiguration{BatchSize: 500, FlushInterval: Duration{time.Second}},
+				Stats:           StatsConfiguration{Retention: Duration{7 * 24 * time.Hour}},
+				Refresh:         RefreshConfiguration{Interval: Duration{time.Hour}, MaxBackoff: Duration{24 * time.Hour}},
+				Listen:          ListenerConfiguration{Network: "tcp", Address: ":80"},
+				ShutdownTimeout: Duration{30 * time.Second}, Fetch: FetchConfiguration{
+					Timeout: Duration{30 * time.Second}, RetryBackoff: Duration{time.Second}, MaxBodyBytes: 16 << 20,
+				}},
+		},
+		{
+			name:    "source with interval and cron",
+			content: `{"Blocklists": [{"Location": "file:///AGBBase.toml", "Interval": "1h", "Cron": "@daily"}], "Reciever": "stub"}`,
+			wantErr: true,
+		},
+		{
+			name:    "source with unparseable cron",
+			content: `{"Blocklists": [{"Location": "file:///AGBBase.toml", "Cron": "every tuesday"}], "Reciever": "stub"}`,
+			wantErr: true,
+		},
+		{
+			name:    "source with unknown format",
+			content: `{"Blocklists": [{"Location": "file:///AGBBase.ini", "Format": "ini"}], "Reciever": "stub"}`,
+			wantErr: true,
+		},
+		{
+			name:    "git source without path",
+			content: `{"Blocklists": ["git+file:///srv/blocklists?ref=main"], "Reciever": "stub"}`,
+			wantErr: true,
+		},
+		{
+			name:    "source with malformed digest",
+			content: `{"Blocklists": [{"Location": "file:///AGBBase.toml", "SHA256": "e3b0c442"}], "Reciever": "stub"}`,
+			wantErr: true,
+		},
+		{
+			name:    "signature location without keys",
+			content: `{"Blocklists": [{"Location": "file:///AGBBase.toml", "SignatureLocation": "file:///AGBBase.toml.sig"}], "Reciever": "stub"}`,
+			wantErr: true,
+		},
+		{
+			name:    "source listed twice",
+			content: `{"Blocklists": ["file:///AGBBase.toml", {"Location": "file:///AGBBase.toml"}], "Reciever": "stub"}`,
+			wantErr: true,
+		},
+		{
+			name:    "unparseable duration",
+			content: `{"Blocklists": ["file:///AGBBase.toml"], "Fetch": {"Timeout": "soon"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "receiver listed twice",
+			content: `{"Blocklists": ["file:///AGBBase.toml"], "Receivers": ["stub", "influxdb", "stub"]}`,
+			wantErr: true,
+		},
+		{
+			name:    "no receivers",
+			content: `{"Blocklists": ["file:///AGBBase.toml"]}`,
+			wantErr: true,
+		},
+		{
+			name: "admin listener on the public one",
+			content: `{"Blocklists": ["file:///AGBBase.toml"], "Reciever": "stub",
+				"Listen": {"Address": ":8080"}, "AdminListen": {"Address": ":8080"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "tls certificate without key",
+			content: `{"Blocklists": ["file:///AGBBase.toml"], "Reciever": "stub", "Listen": {"TLSCertificate": "cert.pem"}}`,
+			wantErr: true,
+		},
+		{
+			name: "rate limits",
+			content: `{"Blocklists": ["file:///AGBBase.toml"], "Reciever": "stub", "TrustedProxies": ["10.0.0.0/8"],
+				"RateLimit": {"PerClient": {"PerSecond": 0.5, "Burst": 10}, "Allowlist": ["192.0.2.1", "2001:db8::/32"]}}`,
+			want: SrvConfiguration{Blocklists: []BlocklistSource{{Location: "file:///AGBBase.toml"}}, Reciever: "stub",
+				ReceiverQueueSize: 1024, CacheDirectory: DefaultCacheDirectory, MaxUnmatchedObjects: 1024,
+				TrustedProxies: []string{"10.0.0.0/8"},
+				RateLimit: RateLimitConfiguration{PerClient: Rate{PerSecond: 0.5, Burst: 10}, MaxTracked: 65536,
+					Allowlist: []string{"192.0.2.1", "2001:db8::/32"}},
+				ReporterIdentity: "address", Dedup: DedupConfiguration{MaxEntries: 100000},
+				Quorum:          QuorumConfiguration{Window: Duration{24 * time.Hour}, MaxEntries: 100000},
+				Ingest:          IngestConfiguration{Workers: 4, QueueSize: 4096, RetryAfter: Duration{5 * time.Second}},
+				Influxdb:        InfluxdbConfiguration{BatchSize: 500, FlushInterval: Duration{time.Second}},
+				Stats:           StatsConfiguration{Retention: Duration{7 * 24 * time.Hour}},
+				Refresh:         RefreshConfiguration{Interval: Duration{time.Hour}, MaxBackoff: Duration{24 * time.Hour}},
+				Listen:          ListenerConfiguration{Network: "tcp", Address: ":80"},
+				ShutdownTimeout: Duration{30 * time.Second}, Fetch: FetchConfiguration{
+					Timeout: Duration{30 * time.Second}, RetryBackoff: Duration{time.Second}, MaxBodyBytes: 16 << 20,
+				}},
+		},
+		{
+			name:    "allowlist entry that isn't an address",
+			content: `{"Blocklists": ["file:///AGBBase.toml"], "Reciever": "stub", "RateLimit": {"Allowlist": ["test-machine"]}}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown reporter identity",
+			content: `{"Blocklists": ["file:///AGBBase.toml"], "Reciever": "stub", "ReporterIdentity": "fingerprint"}`,
+			wantErr: true,
+		},
+		{
+			name:    "negative unmatched object limit",
+			content: `{"Blocklists": ["file:///AGBBase.toml"], "Reciever": "stub", "MaxUnmatchedObjects": -1}`,
+			wantErr: true,
+		},
+		{
+			name:    "malformed json",
+			content: `{"Blocklists": [`,
+			wantErr: true,
+		},
+		{
+			name:    "no blocklists",
+			content: `{"Blocklists": [], "Reciever": "stub"}`,
+			wantErr: true,
+		},
+		{
+			name:    "blocklist that isn't a location",
+			content: `{"Blocklists": ["notaurlreallytrustme"], "Reciever": "stub"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Load(configPath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equalf(t, tt.want, got, "Load(%v)", tt.content)
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	write := func(content string) {
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"Blocklists": ["file:///AGBBase.toml"], "Reciever": "stub"}`)
+	if err := Init(configPath); err != nil {
+		t.Fatal(err)
+	}
+
+	write(`{"Blocklists": [`)
+	assert.Error(t, Reload(), "Reload() should reject malformed configuration")
+	assert.Equal(t, "stub", Current().Reciever, "running configuration should be kept after a rejected reload")
+
+	write(`{"Blocklists": ["file:///AGBBase.toml"], "Reciever": "influxdb"}`)
+	assert.NoError(t, Reload())
+	assert.Equal(t, "influxdb", Current().Reciever)
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/robfig/cron/v3"
+	"net/url"
+	"slices"
+)
+
+// BlocklistSource is a blocklist and how it is refreshed. In the configuration file it's either just the location
+// or an object.
+type BlocklistSource struct {
+	Location string `json:"Location"`
+	// Interval and Cron override RefreshConfiguration.Interval for this source, at most one of them may be set.
+	Interval Duration `json:"Interval"`
+	// Cron is a standard five field cron expression, like "0 */6 * * *".
+	Cron string `json:"Cron"`
+	// Jitter overrides RefreshConfiguration.Jitter for this source.
+	Jitter Duration `json:"Jitter"`
+	// Format is "toml", "json" or "yaml". Left empty, it is detected from the Content-Type or the file extension.
+	Format string `json:"Format"`
+	// SHA256 pins the hex encoded SHA-256 digest of the blocklist, anything else is refused.
+	SHA256 string `json:"SHA256"`
+	// PublicKeys are minisign or bare Ed25519 public keys, the blocklist has to be signed by one of them.
+	PublicKeys []string `json:"PublicKeys"`
+	// SignatureLocation is where the detached signature is, Location with .minisig appended if empty.
+	SignatureLocation string `json:"SignatureLocation"`
+}
+
+var blocklistFormats = []string{"toml", "json", "yaml"}
+
+func (source *BlocklistSource) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &source.Location); err == nil {
+		return nil
+	}
+	type plainSource BlocklistSource // Doesn't inherit UnmarshalJSON, so this doesn't recurse
+	return json.Unmarshal(data, (*plainSource)(source))
+}
+
+// Schedule returns when the source is refreshed next after a given time. It must only be called on sources that
+// passed validation.
+func (source BlocklistSource) Schedule(defaultInterval Duration) cron.Schedule {
+	if source.Cron != "" {
+		schedule, _ := cron.ParseStandard(source.Cron)
+		return schedule
+	}
+	if source.Interval.Duration > 0 {
+		return cron.Every(source.Interval.Duration)
+	}
+	return cron.Every(defaultInterval.Duration)
+}
+
+func (source BlocklistSource) validate() error {
+	uri, err := url.ParseRequestURI(source.Location)
+	if err != nil {
+		return fmt.Errorf("invalid blocklist location %q: %w", source.Location, err)
+	}
+	if uri.Scheme == "git+file" && uri.Query().Get("path") == "" {
+		return errors.New("git blocklist " + source.Location + " has to name the file to read with ?path=")
+	}
+	if source.Interval.Duration < 0 || source.Jitter.Duration < 0 {
+		return fmt.Errorf("refresh interval and jitter of %s can't be negative", source.Location)
+	}
+	if source.Interval.Duration > 0 && source.Cron != "" {
+		return errors.New("blocklist " + source.Location + " has both a refresh interval and a cron expression")
+	}
+	if source.Cron != "" {
+		if _, err := cron.ParseStandard(source.Cron); err != nil {
+			return fmt.Errorf("invalid cron expression for %s: %w", source.Location, err)
+		}
+	}
+	if source.Format != "" && !slices.Contains(blocklistFormats, source.Format) {
+		return fmt.Errorf("unknown format %q for %s, choose one of %v", source.Format, source.Location, blocklistFormats)
+	}
+	if digest, err := hex.DecodeString(source.SHA256); err != nil || (source.SHA256 != "" && len(digest) != sha256.Size) {
+		return fmt.Errorf("SHA256 of %s has to be a hex encoded SHA-256 digest", source.Location)
+	}
+	if source.SignatureLocation != "" {
+		if len(source.PublicKeys) == 0 {
+			return errors.New("blocklist " + source.Location + " has a signature location but no public keys to check it with")
+		}
+		if _, err := url.ParseRequestURI(source.SignatureLocation); err != nil {
+			return fmt.Errorf("invalid signature location for %s: %w", source.Location, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"AGB-BlocklistSrv/Processing"
+	"AGB-BlocklistSrv/config"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hashedBlocklist is what the hash subcommand prints for every blocklist with -json.
+type hashedBlocklist struct {
+	Location string
+	Title    string
+	Worlds   []Processing.HashedWorld
+}
+
+// hashCommand prints the hashes clients send for every world and object of the blocklists named in args, or of the
+// configured ones if there are none. With -lookup, only what matches the given hash is printed.
+func hashCommand(args []string) int {
+	flags := flag.NewFlagSet("hash", flag.ContinueOnError)
+	configPath := flags.String("config", config.PathFromEnvironment(), "configuration to take the blocklists from if none are given")
+	lookup := flags.String("lookup", "", "only print the world or object with this hash, exiting with 1 if there is none")
+	asJSON := flags.Bool("json", false, "print JSON instead of text")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: blocklistsrv hash [-config <path>] [-lookup <hash>] [-json] [blocklist...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	locations, err := commandLocations(flags.Args(), *configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	status := 0
+	var blocklists []hashedBlocklist
+	for _, location := range locations {
+		blocklist, err := Processing.FetchBlocklist(location)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read %s: %s\n", location, err.Error())
+			status = 1
+			continue
+		}
+		worlds := Processing.HashBlocklist(blocklist)
+		if *lookup != "" {
+			worlds = Processing.LookupHash(worlds, *lookup)
+			if len(worlds) == 0 {
+				continue
+			}
+		}
+		blocklists = append(blocklists, hashedBlocklist{Location: location, Title: blocklist.Title, Worlds: worlds})
+	}
+	if *lookup != "" && len(blocklists) == 0 {
+		fmt.Fprintln(os.Stderr, "No world or object hashes to "+*lookup)
+		status = 1
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(blocklists); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		return status
+	}
+	printHashes(os.Stdout, blocklists)
+	return status
+}
+
+func printHashes(output io.Writer, blocklists []hashedBlocklist) {
+	for i, blocklist := range blocklists {
+		if i > 0 {
+			fmt.Fprintln(output)
+		}
+		fmt.Fprintf(output, "%s (%s)\n", blocklist.Title, blocklist.Location)
+		for _, world := range blocklist.Worlds {
+			fmt.Fprintf(output, "  %s  %s  %s\n", world.Hash, world.WorldId, world.FriendlyName)
+			for _, object := range world.Objects {
+				fmt.Fprintf(output, "    %s  %s\n", object.Hash, describeObject(object.Name, object.Position, object.Parent))
+			}
+		}
+	}
+}
+
+// describeObject names an object by its path through its parents, followed by its position if it has one.
+func describeObject(name string, position *Processing.GameobjectPosition, parent *Processing.Gameobject) string {
+	path := []string{name}
+	for ; parent != nil; parent = parent.Parent {
+		path = append([]string{parent.Name}, path...)
+	}
+	description := strings.Join(path, "/")
+	if position != nil {
+		description += fmt.Sprintf(" at (%g, %g, %g)", position.X, position.Y, position.Z)
+	}
+	return description
+}
+
+// commandLocations turns the blocklists given to a subcommand into locations, plain paths become file:// URLs.
+// Without any, the blocklists of the configuration at configPath are used.
+func commandLocations(args []string, configPath string) ([]string, error) {
+	if len(args) == 0 {
+		configuration, err := config.Load(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("no blocklists given and the configuration at %s can't be loaded: %w", configPath, err)
+		}
+		Processing.HTTPDownloader.Configure(downloadOptions(configuration))
+		Processing.SetSourceOptions(sourceOptions(configuration))
+		return configuration.BlocklistLocations(), nil
+	}
+
+	locations := make([]string, 0, len(args))
+	for _, arg := range args {
+		if uri, err := url.ParseRequestURI(arg); err == nil && uri.Scheme != "" {
+			locations = append(locations, arg)
+			continue
+		}
+		path, err := filepath.Abs(arg)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String())
+	}
+	return locations, nil
+}
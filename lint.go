@@ -0,0 +1,55 @@
+package main
+
+import (
+	"AGB-BlocklistSrv/Processing"
+	"AGB-BlocklistSrv/config"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// lintCommand checks the blocklists named in args, or the configured ones if there are none. It exits with 1 if
+// anything was found, so it can gate changes to blocklists.
+func lintCommand(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	configPath := flags.String("config", config.PathFromEnvironment(), "configuration to take the blocklists from if none are given")
+	asJSON := flags.Bool("json", false, "print JSON instead of text")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: blocklistsrv lint [-config <path>] [-json] [blocklist...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	locations, err := commandLocations(flags.Args(), *configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+
+	findings := Processing.LintLocations(locations)
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if findings == nil {
+			findings = []Processing.LintFinding{} // Tooling shouldn't have to tell null from no findings
+		}
+		if err := encoder.Encode(findings); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 2
+		}
+	} else {
+		for _, finding := range findings {
+			fmt.Println(finding.String())
+		}
+		fmt.Fprintf(os.Stderr, "%d blocklists checked, %d problems found\n", len(locations), len(findings))
+	}
+
+	if len(findings) > 0 {
+		return 1
+	}
+	return 0
+}
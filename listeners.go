@@ -0,0 +1,129 @@
+package main
+
+import (
+	"AGB-BlocklistSrv/config"
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/gofiber/fiber/v2/log"
+	"io/fs"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// listen opens the listener described by listener, wrapping it in TLS if a certificate is configured.
+// Certificates are re-read when they change on disk until ctx is done.
+func listen(ctx context.Context, listener config.ListenerConfiguration) (net.Listener, error) {
+	if listener.Network == "unix" {
+		if err := removeStaleSocket(listener.Address); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen(listener.Network, listener.Address)
+	if err != nil {
+		return nil, err
+	}
+	if listener.TLSCertificate == "" {
+		return ln, nil
+	}
+
+	reloader, err := newCertificateReloader(listener.TLSCertificate, listener.TLSKey)
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	go reloader.watch(ctx, 30*time.Second)
+	return tls.NewListener(ln, &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.getCertificate,
+	}), nil
+}
+
+// removeStaleSocket removes a socket left behind by a previous run, which would make listening fail.
+// Anything that isn't a socket is left alone.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		return errors.New(path + " exists and is not a socket")
+	}
+	return os.Remove(path)
+}
+
+// certificateReloader serves a certificate key pair and picks up renewals without a restart.
+type certificateReloader struct {
+	certificatePath, keyPath string
+
+	mutex        sync.RWMutex
+	certificate  *tls.Certificate
+	lastModified time.Time
+}
+
+func newCertificateReloader(certificatePath, keyPath string) (*certificateReloader, error) {
+	reloader := &certificateReloader{certificatePath: certificatePath, keyPath: keyPath}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func (reloader *certificateReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.mutex.RLock()
+	defer reloader.mutex.RUnlock()
+	return reloader.certificate, nil
+}
+
+func (reloader *certificateReloader) load() error {
+	certificate, err := tls.LoadX509KeyPair(reloader.certificatePath, reloader.keyPath)
+	if err != nil {
+		return err
+	}
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+	reloader.certificate = &certificate
+	reloader.lastModified = reloader.modified()
+	return nil
+}
+
+// modified returns when either half of the key pair was last changed.
+func (reloader *certificateReloader) modified() time.Time {
+	var latest time.Time
+	for _, path := range []string{reloader.certificatePath, reloader.keyPath} {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+func (reloader *certificateReloader) watch(ctx context.Context, pollInterval time.Duration) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloader.mutex.RLock()
+		lastModified := reloader.lastModified
+		reloader.mutex.RUnlock()
+		if reloader.modified().Equal(lastModified) {
+			continue
+		}
+		// Certificate and key are rarely replaced in one go, a mismatched pair fails here and is retried next tick
+		if err := reloader.load(); err != nil {
+			log.Warnf("Failed to reload TLS certificate %s, keeping the current one: %s", reloader.certificatePath, err.Error())
+			continue
+		}
+		log.Infof("Reloaded TLS certificate %s", reloader.certificatePath)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"AGB-BlocklistSrv/config"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate for commonName and its key, and returns the certificate.
+func writeCertificate(t *testing.T, certificatePath, keyPath, commonName string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedKey, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(certificatePath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: encodedKey}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certificate
+}
+
+func TestCertificateReloader(t *testing.T) {
+	directory := t.TempDir()
+	certificatePath, keyPath := filepath.Join(directory, "fullchain.pem"), filepath.Join(directory, "privkey.pem")
+	original := writeCertificate(t, certificatePath, keyPath, "original")
+	reloader, err := newCertificateReloader(certificatePath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := func() []byte {
+		certificate, err := reloader.getCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return certificate.Certificate[0]
+	}
+	assert.Equal(t, original, served())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.watch(ctx, 10*time.Millisecond)
+	renewed := writeCertificate(t, certificatePath, keyPath, "renewed")
+	// File systems with coarse timestamps might not tell the renewal apart otherwise
+	later := time.Now().Add(time.Minute)
+	for _, path := range []string{certificatePath, keyPath} {
+		if err = os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Eventually(t, func() bool { return string(served()) == string(renewed) }, time.Second, 10*time.Millisecond,
+		"renewed certificate should be served without a restart")
+
+	if err = os.WriteFile(keyPath, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chtimes(keyPath, later.Add(time.Minute), later.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, renewed, served(), "a broken key pair should keep the current certificate")
+}
+
+func Test_removeStaleSocket(t *testing.T) {
+	directory := t.TempDir()
+	socket := filepath.Join(directory, "srv.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Like a crashed process, which leaves the socket behind
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	ln, err = listen(context.Background(), config.ListenerConfiguration{Network: "unix", Address: socket})
+	if assert.NoError(t, err, "a leftover socket should be replaced") {
+		ln.Close()
+	}
+
+	regular := filepath.Join(directory, "blocklistsrv.toml")
+	if err = os.WriteFile(regular, []byte("title = \"AGBTest\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = listen(context.Background(), config.ListenerConfiguration{Network: "unix", Address: regular})
+	assert.Error(t, err)
+	assert.FileExists(t, regular, "anything but a socket should be left alone")
+
+	assert.NoError(t, removeStaleSocket(filepath.Join(directory, "missing.sock")))
+}
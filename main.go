@@ -1,74 +1,444 @@
 package main
 
 import (
+	"AGB-BlocklistSrv/Metrics"
 	"AGB-BlocklistSrv/Processing"
 	"AGB-BlocklistSrv/Pushers"
 	"AGB-BlocklistSrv/Receivers"
 	"AGB-BlocklistSrv/config"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
+var (
+	pusherOperational atomic.Bool
+	scheduler         atomic.Pointer[Processing.Scheduler]
+	// retiring tracks fanouts and ingest queues a reload replaced while they drain, so shutdown can wait for them
+	retiring sync.WaitGroup
+)
+
+// subcommands run instead of the server if their name is the first argument, their result is the exit code.
+var subcommands = map[string]func(args []string) int{
+	"hash": hashCommand,
+	"lint": lintCommand,
+}
+
 func main() {
-	app := fiber.New(fiber.Config{
-		Network: fiber.NetworkTCP,
-	})
+	if len(os.Args) > 1 {
+		if subcommand, exists := subcommands[os.Args[1]]; exists {
+			os.Exit(subcommand(os.Args[2:]))
+		}
+	}
 
-	Processing.Index.Index = Processing.GenerateObjectIndex(config.Configuration.Blocklists)
+	configPath := flag.String("config", config.PathFromEnvironment(), "path to the configuration file, also settable through BLOCKLISTSRV_CONFIG")
+	flag.Parse()
+	// SIGHUP would kill us until config.Watch runs, which only happens once the index is built
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
 
-	app.Use(recover.New())
-	log.Infof("Loaded %d blocks, passing to Fiber", len(Processing.Index.Index))
+	config.AddValidator(validateChoices)
+	if err := config.Init(*configPath); err != nil {
+		log.Fatalf("Failed to load configuration from %s: %s", *configPath, err.Error())
+	}
+	config.OnReload(applyConfiguration)
+	if len(adminToken) == 0 {
+		log.Warn("BLOCKLISTSRV_ADMIN_TOKEN is unset, the /admin and monitoring endpoints are disabled")
+	}
 
+	Processing.Cache.SetDirectory(config.Current().CacheDirectory)
+	Processing.HTTPDownloader.Configure(downloadOptions(config.Current()))
+	Processing.SetSourceOptions(sourceOptions(config.Current()))
+	Receivers.MissStatistics.SetRetention(config.Current().Stats.Retention.Duration)
+	snapshot := Processing.Index.Rebuild(config.Current().BlocklistLocations())
+	log.Infof("Loaded %d blocks, passing to Fiber", len(snapshot.Index))
+
+	fanout, _ := buildFanout(config.Current())
+	Processing.SetReceivers(fanout)
+	Processing.SetIngest(buildIngestQueue(config.Current()))
+	currentLimits.Store(buildCallbackLimits(config.Current()))
+	Processing.SetMissFilters(buildMissFilters(config.Current())...)
+	pusher, _ := ChoosePusherFromConfig(config.Current())
+	Processing.SetPusher(pusher)
+	pusherOperational.Store(pusher.CanPusherOperate())
+
+	// Without a separate admin listener, everything is served from the public one like it always was
+	app := newApp()
+	apps := []*fiber.App{app}
+	admin := app
+	if config.Current().AdminListen != nil {
+		admin = newApp()
+		apps = append(apps, admin)
+	}
+
+	registerRoutes(app, admin)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	go config.Watch(5*time.Second, hangup, ctx.Done())
+	scheduler.Store(startScheduler(config.Current()))
+
+	listenErr := make(chan error, len(apps))
+	serve(ctx, app, config.Current().Listen, listenErr)
+	if admin != app {
+		serve(ctx, admin, *config.Current().AdminListen, listenErr)
+	}
+
+	select {
+	case err := <-listenErr:
+		if err != nil {
+			panic(err)
+		}
+	case <-ctx.Done():
+		stop() // A second signal kills us the usual way
+		scheduler.Load().Stop()
+		shutdown(apps, config.Current().ShutdownTimeout.Duration)
+	}
+}
+
+// registerRoutes serves callbacks from app and everything else from admin, which may be app itself.
+func registerRoutes(app, admin *fiber.App) {
 	v1Group := app.Group("/v1")
 	v1Group.Post("/BlocklistCallback", submitBlocklistHit)
 
-	Processing.ChosenReceiver = ChooseReceiverFromConfig()
-	Processing.ChosenPusher = ChoosePusherFromConfig()
+	// Routes get requireAdminToken one by one, as a group middleware on /v1 would also guard callbacks on a shared app
+	adminV1Group := admin.Group("/v1")
+	adminV1Group.Post("pusher", handlePushRequest)
+	adminV1Group.Get("/receivers", requireAdminToken, receiverStats)
+	adminV1Group.Get("/ingest", requireAdminToken, ingestStats)
+	adminV1Group.Get("/stats", requireAdminToken, missStatistics)
+	admin.Get("/metrics", requireAdminToken, metricsHandler)
+
+	adminGroup := admin.Group("/admin", requireAdminToken)
+	adminGroup.Get("/index", describeIndex)
+	adminGroup.Get("/index/worlds", listWorlds)
+	adminGroup.Get("/index/worlds/*", listWorldObjects)
+	adminGroup.Get("/index/objects", searchObjects)
+	adminGroup.Post("/reindex", reindex)
+	adminGroup.Get("/sources", sourceStatuses)
+}
+
+func newApp() *fiber.App {
+	app := fiber.New(fiber.Config{
+		Network:      fiber.NetworkTCP,
+		ErrorHandler: renderProblem,
+	})
+	app.Use(recover.New())
+	return app
+}
+
+// renderProblem answers every error a handler returns with an RFC 7807 problem, so clients get something they can
+// act on instead of an opaque 500.
+func renderProblem(c *fiber.Ctx, err error) error {
+	var problem *Processing.Problem
+	var fiberErr *fiber.Error
+	switch {
+	case errors.As(err, &problem):
+	case errors.As(err, &fiberErr):
+		problem = Processing.NewProblem(fiberErr.Code, fiberErr.Message)
+		if fiberErr.Message == problem.Title { // fiber.NewError without a message repeats the status text
+			problem.Detail = ""
+		}
+	default:
+		log.Errorf("Failed to serve %s %s: %s", c.Method(), c.Path(), err.Error())
+		problem = Processing.NewProblem(fiber.StatusInternalServerError, "")
+	}
+	return c.Status(problem.Status).JSON(problem, "application/problem+json")
+}
+
+// serve starts serving app on listener in the background, errors end up in listenErr.
+func serve(ctx context.Context, app *fiber.App, listener config.ListenerConfiguration, listenErr chan<- error) {
+	ln, err := listen(ctx, listener)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s %s: %s", listener.Network, listener.Address, err.Error())
+	}
+	go func() {
+		listenErr <- app.Listener(ln)
+	}()
+}
+
+// shutdown stops accepting callbacks, lets in-flight ones finish and drains everything queued towards the receivers.
+// Whatever isn't done by the time timeout runs out is abandoned.
+func shutdown(apps []*fiber.App, timeout time.Duration) {
+	log.Infof("Shutting down, waiting up to %s for in-flight callbacks and receivers", timeout)
+	deadline := time.Now().Add(timeout)
 
-	if Processing.ChosenPusher.CanPusherOperate() {
-		v1Group.Post("pusher", Processing.ChosenPusher.HandlePushRequest)
-	} else {
+	var shuttingDown sync.WaitGroup
+	for _, app := range apps {
+		shuttingDown.Add(1)
 		go func() {
-			for range time.Tick(time.Hour * 1) { // TODO: Make this configurable
-				Processing.Index.Index = Processing.GenerateObjectIndex(config.Configuration.Blocklists)
+			defer shuttingDown.Done()
+			if err := app.ShutdownWithTimeout(timeout); err != nil {
+				log.Errorf("Failed to finish in-flight requests: %s", err.Error())
 			}
 		}()
 	}
+	shuttingDown.Wait()
 
-	err := app.Listen(":80")
-	if err != nil {
-		panic(err)
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		Processing.Ingest().Close()
+		// Retired ingest queues still hand misses to the current receivers, which are closed once they're done
+		retiring.Wait()
+		Processing.Receivers().Close()
+	}()
+	select {
+	case <-drained:
+		log.Info("Shutdown complete")
+	case <-time.After(time.Until(deadline)):
+		log.Errorf("Shutdown deadline exceeded, abandoning %d queued callbacks", Processing.Ingest().Stats().Queued)
 	}
 }
 func submitBlocklistHit(c *fiber.Ctx) error {
 	c.Accepts("application/json")
-	var Callback Processing.CallbackContainer
+	limits := currentLimits.Load()
+	client := limits.clientAddress(c)
+	if !client.IsValid() {
+		return Processing.NewProblem(fiber.StatusBadRequest, "the proxy didn't say who it forwards for in X-Forwarded-For")
+	}
+	if err := limits.allow(c, limits.perClient, "client", clientKey(client), client); err != nil {
+		return err
+	}
 
-	if err := c.BodyParser(&Callback); err != nil {
-		panic(err)
+	Callback, err := Processing.DecodeCallback(c.Body(), Processing.CallbackOptions{
+		DeniedClientVersions: config.Current().DeniedClientVersions,
+		MaxUnmatchedObjects:  config.Current().MaxUnmatchedObjects,
+	})
+	if err != nil {
+		return err
+	}
+	if err = limits.allow(c, limits.perWorld, "world", Callback.WorldId, client); err != nil {
+		return err
 	}
-	Processing.Index.HandleBlocklistCallback(Callback)
+	Callback.Reporter = Processing.ReporterFromAddress(client)
+	if config.Current().ReporterIdentity == "installid" && Callback.InstallId != "" {
+		Callback.Reporter = Processing.ReporterFromInstallId(Callback.InstallId)
+	}
+	if !Processing.Ingest().Submit(Callback) {
+		setRetryAfter(c, config.Current().Ingest.RetryAfter.Duration)
+		return fiber.NewError(fiber.StatusServiceUnavailable, "too many callbacks queued, try again later")
+	}
+	Metrics.CallbacksReceived.Inc()
 
 	return c.SendStatus(fiber.StatusNoContent)
 }
-func ChooseReceiverFromConfig() Processing.Receiver {
-	switch config.Configuration.Reciever {
-	case "influxdb":
-		return Receivers.Influxdb{}
-	case "stub":
+
+func ingestStats(c *fiber.Ctx) error {
+	return c.JSON(Processing.Ingest().Stats())
+}
+
+func receiverStats(c *fiber.Ctx) error {
+	return c.JSON(Processing.Receivers().Stats())
+}
+
+func handlePushRequest(c *fiber.Ctx) error {
+	if !pusherOperational.Load() {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "pusher is not operational")
+	}
+	return Processing.ChosenPusher().HandlePushRequest(c)
+}
+
+// applyConfiguration carries changes of a reloaded configuration over into the running server.
+func applyConfiguration(previous, current config.SrvConfiguration) {
+	if !slices.Equal(current.ReceiverNames(), previous.ReceiverNames()) || current.ReceiverQueueSize != previous.ReceiverQueueSize ||
+		current.Influxdb != previous.Influxdb {
+		fanout, _ := buildFanout(current)
+		retire(Processing.SetReceivers(fanout)) // Let the old receivers drain in peace
+		log.Infof("Switched receivers from %v to %v", previous.ReceiverNames(), current.ReceiverNames())
+	}
+	if current.Listen != previous.Listen || !reflect.DeepEqual(current.AdminListen, previous.AdminListen) {
+		log.Warn("Listener changes only take effect after a restart")
+	}
+	if current.Ingest.Workers != previous.Ingest.Workers || current.Ingest.QueueSize != previous.Ingest.QueueSize {
+		retire(Processing.SetIngest(buildIngestQueue(current)))
+		log.Infof("Resized ingest queue to %d callbacks over %d workers", current.Ingest.QueueSize, current.Ingest.Workers)
+	}
+	if current.Pusher != previous.Pusher {
+		pusher, _ := ChoosePusherFromConfig(current)
+		Processing.SetPusher(pusher)
+		pusherOperational.Store(pusher.CanPusherOperate())
+		log.Infof("Switched pusher from %s to %s", previous.Pusher, current.Pusher)
+	}
+	if current.RateLimit.PerClient != previous.RateLimit.PerClient || current.RateLimit.PerWorld != previous.RateLimit.PerWorld ||
+		current.RateLimit.MaxTracked != previous.RateLimit.MaxTracked ||
+		!slices.Equal(current.RateLimit.Allowlist, previous.RateLimit.Allowlist) ||
+		!slices.Equal(current.TrustedProxies, previous.TrustedProxies) {
+		currentLimits.Store(buildCallbackLimits(current))
+		log.Info("Applied new rate limits")
+	}
+	if current.Dedup != previous.Dedup || current.Quorum != previous.Quorum {
+		Processing.SetMissFilters(buildMissFilters(current)...)
+		log.Info("Applied new miss filters, misses held back so far are forgotten")
+	}
+	if current.Stats != previous.Stats {
+		Receivers.MissStatistics.SetRetention(current.Stats.Retention.Duration)
+	}
+	if current.CacheDirectory != previous.CacheDirectory {
+		Processing.Cache.SetDirectory(current.CacheDirectory)
+	}
+	if current.Fetch != previous.Fetch {
+		Processing.HTTPDownloader.Configure(downloadOptions(current))
+	}
+	optionsChanged := !reflect.DeepEqual(sourceOptions(current), sourceOptions(previous))
+	if optionsChanged {
+		Processing.SetSourceOptions(sourceOptions(current))
+	}
+	if optionsChanged || !slices.Equal(current.BlocklistLocations(), previous.BlocklistLocations()) {
+		snapshot := Processing.Index.Rebuild(current.BlocklistLocations())
+		log.Infof("Blocklists changed, reindexed %d blocks as generation %d", len(snapshot.Index), snapshot.Generation)
+	}
+	if !reflect.DeepEqual(current.Blocklists, previous.Blocklists) || current.Refresh != previous.Refresh {
+		scheduler.Swap(startScheduler(current)).Stop()
+		log.Info("Rescheduled blocklist refreshes")
+	}
+}
+
+// retire closes what a reload replaced in the background.
+func retire(replaced interface{ Close() }) {
+	retiring.Add(1)
+	go func() {
+		defer retiring.Done()
+		replaced.Close()
+	}()
+}
+
+// startScheduler starts refreshing every configured blocklist on its own schedule.
+func startScheduler(configuration config.SrvConfiguration) *Processing.Scheduler {
+	sources := make([]Processing.ScheduledSource, 0, len(configuration.Blocklists))
+	for _, source := range configuration.Blocklists {
+		jitter := configuration.Refresh.Jitter
+		if source.Jitter.Duration > 0 {
+			jitter = source.Jitter
+		}
+		sources = append(sources, Processing.ScheduledSource{
+			Location: source.Location,
+			Schedule: source.Schedule(configuration.Refresh.Interval),
+			Jitter:   jitter.Duration,
+		})
+	}
+	return Processing.StartScheduler(sources, configuration.Refresh.MaxBackoff.Duration, refreshSource)
+}
+
+// sourceOptions collects how every configured blocklist is fetched and parsed.
+func sourceOptions(configuration config.SrvConfiguration) map[string]Processing.SourceOptions {
+	options := make(map[string]Processing.SourceOptions, len(configuration.Blocklists))
+	for _, source := range configuration.Blocklists {
+		options[source.Location] = Processing.SourceOptions{
+			Format:            source.Format,
+			SHA256:            source.SHA256,
+			PublicKeys:        source.PublicKeys,
+			SignatureLocation: source.SignatureLocation,
+		}
+	}
+	return options
+}
+
+// refreshSource fetches location again and publishes the result, every other source keeps what it has.
+func refreshSource(location string) {
+	snapshot := Processing.Index.Refresh(config.Current().BlocklistLocations(), []string{location})
+	log.Infof("Refreshed %s, index is at generation %d with %d blocks", location, snapshot.Generation, len(snapshot.Index))
+}
+
+func downloadOptions(configuration config.SrvConfiguration) Processing.DownloadOptions {
+	return Processing.DownloadOptions{
+		Timeout:      configuration.Fetch.Timeout.Duration,
+		Retries:      configuration.Fetch.Retries,
+		RetryBackoff: configuration.Fetch.RetryBackoff.Duration,
+		MaxBodyBytes: configuration.Fetch.MaxBodyBytes,
+	}
+}
+
+// validateChoices rejects configurations naming receivers or pushers that don't exist.
+func validateChoices(configuration config.SrvConfiguration) error {
+	for _, name := range configuration.ReceiverNames() {
+		if _, exists := receiverFactories[name]; !exists {
+			return errors.New("invalid receiver: " + name)
+		}
+	}
+	if _, err := ChoosePusherFromConfig(configuration); err != nil {
+		return err
+	}
+	for _, source := range configuration.Blocklists {
+		for _, key := range source.PublicKeys {
+			if err := Processing.ValidatePublicKey(key); err != nil {
+				return fmt.Errorf("invalid public key for %s: %w", source.Location, err)
+			}
+		}
+	}
+	return nil
+}
+
+func buildIngestQueue(configuration config.SrvConfiguration) *Processing.IngestQueue {
+	return Processing.NewIngestQueue(configuration.Ingest.Workers, configuration.Ingest.QueueSize, Processing.Index.HandleBlocklistCallback)
+}
+
+// buildMissFilters returns the filters misses pass through before they reach the receivers, in order.
+func buildMissFilters(configuration config.SrvConfiguration) (filters []Processing.MissFilter) {
+	// Quorum goes first, so only misses that would actually be passed on count as held back duplicates
+	if quorum := configuration.Quorum; quorum.Reporters > 1 {
+		filters = append(filters, Processing.NewQuorum(quorum.Reporters, quorum.Window.Duration, quorum.MaxEntries))
+	}
+	if configuration.Dedup.Window.Duration > 0 {
+		filters = append(filters, Processing.NewDeduplicator(configuration.Dedup.Window.Duration, configuration.Dedup.MaxEntries))
+	}
+	return filters
+}
+
+func buildFanout(configuration config.SrvConfiguration) (*Processing.Fanout, error) {
+	var receivers []Processing.NamedReceiver
+	for _, name := range configuration.ReceiverNames() {
+		receiver, err := ChooseReceiverFromConfig(name, configuration)
+		if err != nil {
+			return nil, err
+		}
+		receivers = append(receivers, Processing.NamedReceiver{Name: name, Receiver: receiver})
+	}
+	return Processing.NewFanout(receivers, configuration.ReceiverQueueSize), nil
+}
+
+// receiverFactories holds every receiver that can be configured, by name.
+var receiverFactories = map[string]func(configuration config.SrvConfiguration) Processing.Receiver{
+	"influxdb": func(configuration config.SrvConfiguration) Processing.Receiver {
+		return Receivers.NewInfluxdb(Receivers.InfluxdbOptions{
+			BatchSize:     configuration.Influxdb.BatchSize,
+			FlushInterval: configuration.Influxdb.FlushInterval.Duration,
+		})
+	},
+	"stub": func(config.SrvConfiguration) Processing.Receiver {
 		return Receivers.Stub{}
-	default:
-		panic("Invalid receiver")
+	},
+	"stats": func(config.SrvConfiguration) Processing.Receiver {
+		return Receivers.MissStatistics
+	},
+}
+
+func ChooseReceiverFromConfig(name string, configuration config.SrvConfiguration) (Processing.Receiver, error) {
+	factory, exists := receiverFactories[name]
+	if !exists {
+		return nil, errors.New("invalid receiver: " + name)
 	}
+	return factory(configuration), nil
 }
 
-func ChoosePusherFromConfig() Processing.Pusher {
-	switch config.Configuration.Pusher {
+func ChoosePusherFromConfig(configuration config.SrvConfiguration) (Processing.Pusher, error) {
+	switch configuration.Pusher {
 	case "grafghanno":
-		return Pushers.GrafanaGithubWebhookAnnotation{}
+		return Pushers.GrafanaGithubWebhookAnnotation{}, nil
 	default:
-		panic("Invalid pusher")
+		return nil, errors.New("invalid pusher: " + configuration.Pusher)
 	}
 }
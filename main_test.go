@@ -0,0 +1,96 @@
+package main
+
+import (
+	"AGB-BlocklistSrv/Processing"
+	"AGB-BlocklistSrv/config"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useConfiguration makes content the current configuration.
+func useConfiguration(t *testing.T, content string) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Init(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// useAdminToken sets the admin token for the duration of the test.
+func useAdminToken(t *testing.T, token string) {
+	previous := adminToken
+	adminToken = []byte(token)
+	t.Cleanup(func() { adminToken = previous })
+}
+
+func TestSharedListenerRequiresAdminToken(t *testing.T) {
+	useConfiguration(t, `{"Blocklists": ["file:///AGBBase.toml"], "Receivers": ["stats"], "Pusher": "grafghanno"}`)
+	useAdminToken(t, "AGBAdmin")
+	Processing.SetReceivers(Processing.NewFanout(nil, 1))
+	Processing.SetIngest(Processing.NewIngestQueue(1, 1, Processing.Index.HandleBlocklistCallback))
+	app := newApp()
+	registerRoutes(app, app)
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{"no token", "", fiber.StatusUnauthorized},
+		{"wrong token", "Bearer AGBGuess", fiber.StatusUnauthorized},
+		{"admin token", "Bearer AGBAdmin", fiber.StatusOK},
+	}
+	for _, path := range []string{"/v1/stats", "/v1/receivers", "/v1/ingest", "/metrics"} {
+		for _, tt := range tests {
+			t.Run(path+" "+tt.name, func(t *testing.T) {
+				request := httptest.NewRequest(fiber.MethodGet, path, nil)
+				if tt.authorization != "" {
+					request.Header.Set(fiber.HeaderAuthorization, tt.authorization)
+				}
+				resp, err := app.Test(request)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.want, resp.StatusCode)
+			})
+		}
+	}
+}
+
+// slowReceiver takes a while with every report, like a remote under load.
+type slowReceiver struct {
+	delay     time.Duration
+	delivered *atomic.Int32
+}
+
+func (receiver slowReceiver) SendToRemote(Processing.MissReport) error {
+	time.Sleep(receiver.delay)
+	receiver.delivered.Add(1)
+	return nil
+}
+
+func TestShutdownFlushesReplacedReceivers(t *testing.T) {
+	var retired, current atomic.Int32
+	Processing.SetIngest(Processing.NewIngestQueue(1, 1, Processing.Index.HandleBlocklistCallback))
+	Processing.SetReceivers(Processing.NewFanout([]Processing.NamedReceiver{{Name: "retired", Receiver: slowReceiver{20 * time.Millisecond, &retired}}}, 16))
+	for range 10 {
+		Processing.Receivers().Deliver(Processing.MissReport{})
+	}
+	// A reload swaps the receivers out while the old ones still have reports queued
+	retire(Processing.SetReceivers(Processing.NewFanout([]Processing.NamedReceiver{{Name: "current", Receiver: slowReceiver{time.Millisecond, &current}}}, 16)))
+	for range 10 {
+		Processing.Receivers().Deliver(Processing.MissReport{})
+	}
+
+	shutdown(nil, 5*time.Second)
+	assert.Equal(t, int32(10), retired.Load(), "replaced receivers should be flushed before shutting down")
+	assert.Equal(t, int32(10), current.Load())
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"AGB-BlocklistSrv/Processing"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var metricsHandler = adaptor.HTTPHandler(promhttp.Handler())
+
+// queueCollector reports how full the ingest and receiver queues currently are. The queues get swapped out on
+// reload, so their depth is read at scrape time instead of being tracked.
+type queueCollector struct {
+	ingestQueued, ingestCapacity     *prometheus.Desc
+	receiverQueued, receiverCapacity *prometheus.Desc
+}
+
+func init() {
+	prometheus.MustRegister(&queueCollector{
+		ingestQueued: prometheus.NewDesc("blocklistsrv_ingest_queued",
+			"Callbacks waiting to be matched against the index.", nil, nil),
+		ingestCapacity: prometheus.NewDesc("blocklistsrv_ingest_capacity",
+			"Callbacks the ingest queue holds before turning clients away.", nil, nil),
+		receiverQueued: prometheus.NewDesc("blocklistsrv_receiver_queued",
+			"Reports waiting to be delivered, by receiver.", []string{"receiver"}, nil),
+		receiverCapacity: prometheus.NewDesc("blocklistsrv_receiver_capacity",
+			"Reports a receiver's queue holds before dropping them.", []string{"receiver"}, nil),
+	})
+}
+
+func (collector *queueCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- collector.ingestQueued
+	descs <- collector.ingestCapacity
+	descs <- collector.receiverQueued
+	descs <- collector.receiverCapacity
+}
+
+func (collector *queueCollector) Collect(metrics chan<- prometheus.Metric) {
+	if ingest := Processing.Ingest(); ingest != nil {
+		stats := ingest.Stats()
+		metrics <- prometheus.MustNewConstMetric(collector.ingestQueued, prometheus.GaugeValue, float64(stats.Queued))
+		metrics <- prometheus.MustNewConstMetric(collector.ingestCapacity, prometheus.GaugeValue, float64(stats.Capacity))
+	}
+	if fanout := Processing.Receivers(); fanout != nil {
+		for _, stats := range fanout.Stats() {
+			metrics <- prometheus.MustNewConstMetric(collector.receiverQueued, prometheus.GaugeValue, float64(stats.Queued), stats.Name)
+			metrics <- prometheus.MustNewConstMetric(collector.receiverCapacity, prometheus.GaugeValue, float64(stats.Capacity), stats.Name)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"AGB-BlocklistSrv/Metrics"
+	"AGB-BlocklistSrv/Processing"
+	"AGB-BlocklistSrv/config"
+	"github.com/gofiber/fiber/v2"
+	"math"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// callbackLimits throttles callbacks per client and per world. It is replaced as a whole when the configuration
+// changes, which also forgets every bucket.
+type callbackLimits struct {
+	perClient      *Processing.RateLimiter
+	perWorld       *Processing.RateLimiter
+	allowlist      []netip.Prefix
+	trustedProxies []netip.Prefix
+}
+
+var currentLimits atomic.Pointer[callbackLimits]
+
+func buildCallbackLimits(configuration config.SrvConfiguration) *callbackLimits {
+	// Both were checked when the configuration was loaded
+	allowlist, _ := config.ParsePrefixes(configuration.RateLimit.Allowlist)
+	trustedProxies, _ := config.ParsePrefixes(configuration.TrustedProxies)
+	rateLimit := configuration.RateLimit
+	return &callbackLimits{
+		perClient:      Processing.NewRateLimiter(rateLimit.PerClient.PerSecond, rateLimit.PerClient.Burst, rateLimit.MaxTracked),
+		perWorld:       Processing.NewRateLimiter(rateLimit.PerWorld.PerSecond, rateLimit.PerWorld.Burst, rateLimit.MaxTracked),
+		allowlist:      allowlist,
+		trustedProxies: trustedProxies,
+	}
+}
+
+// clientAddress tells which address a request comes from. Requests from trusted proxies are attributed to the
+// right-most untrusted X-Forwarded-For entry, so whatever a client puts in the header itself is never believed.
+// If a trusted proxy doesn't say who it forwards for, the returned address is invalid, as everyone behind it would
+// otherwise share one bucket and reporter identity.
+func (limits *callbackLimits) clientAddress(c *fiber.Ctx) netip.Addr {
+	remote, _ := netip.AddrFromSlice(c.Context().RemoteIP())
+	remote = remote.Unmap()
+	// Unix sockets have no remote address, whatever is on the other end runs on this machine and is trusted like a proxy
+	if remote.IsValid() && !remote.IsUnspecified() && !containsAddr(limits.trustedProxies, remote) {
+		return remote
+	}
+
+	client := netip.Addr{}
+	forwarded := strings.Split(c.Get(fiber.HeaderXForwardedFor), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		client = hop.Unmap()
+		if !containsAddr(limits.trustedProxies, client) {
+			break
+		}
+	}
+	return client
+}
+
+// allow takes a token for key from limiter unless client is allowlisted. name says what is being limited.
+func (limits *callbackLimits) allow(c *fiber.Ctx, limiter *Processing.RateLimiter, name, key string, client netip.Addr) error {
+	if containsAddr(limits.allowlist, client) {
+		return nil
+	}
+	allowed, wait := limiter.Allow(key, time.Now())
+	if allowed {
+		return nil
+	}
+	Metrics.RateLimited.WithLabelValues(name).Inc()
+	setRetryAfter(c, wait)
+	return Processing.NewProblem(fiber.StatusTooManyRequests, "too many callbacks for this "+name+", try again later")
+}
+
+// clientKey is what client is rate limited by. IPv6 clients share a bucket per /64, as they tend to rotate through
+// addresses within it.
+func clientKey(client netip.Addr) string {
+	if client.Is6() {
+		return netip.PrefixFrom(client, 64).Masked().String()
+	}
+	return client.String()
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// setRetryAfter tells the client to wait at least wait before trying again.
+func setRetryAfter(c *fiber.Ctx, wait time.Duration) {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
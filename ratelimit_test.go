@@ -0,0 +1,77 @@
+package main
+
+import (
+	"AGB-BlocklistSrv/config"
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func Test_clientAddress(t *testing.T) {
+	tests := []struct {
+		name           string
+		network        string
+		trustedProxies []string
+		forwardedFor   string
+		want           string // clientKey of the address, empty if the request can't be attributed
+	}{
+		{"direct", "tcp", nil, "", "127.0.0.1"},
+		{"spoofed X-Forwarded-For from untrusted peer", "tcp", nil, "203.0.113.9", "127.0.0.1"},
+		{"through trusted proxy", "tcp", []string{"127.0.0.1"}, "203.0.113.9", "203.0.113.9"},
+		{"multiple hops through trusted proxies", "tcp", []string{"127.0.0.0/8", "10.0.0.0/8"}, "198.51.100.7, 203.0.113.9, 10.0.0.2", "203.0.113.9"},
+		{"only trusted proxies", "tcp", []string{"127.0.0.0/8", "10.0.0.0/8"}, "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"garbage hop ends the chain", "tcp", []string{"127.0.0.1"}, "203.0.113.9, unknown", ""},
+		{"trusted proxy without X-Forwarded-For", "tcp", []string{"127.0.0.1"}, "", ""},
+		{"IPv6 client folded to its /64", "tcp", []string{"127.0.0.1"}, "2001:db8:1:2:3:4:5:6", "2001:db8:1:2::/64"},
+		{"IPv4-mapped IPv6 client", "tcp", []string{"127.0.0.1"}, "::ffff:203.0.113.9", "203.0.113.9"},
+		{"Unix socket peer", "unix", nil, "203.0.113.9", "203.0.113.9"},
+		{"Unix socket peer without X-Forwarded-For", "unix", nil, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trustedProxies, err := config.ParsePrefixes(tt.trustedProxies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			limits := &callbackLimits{trustedProxies: trustedProxies}
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				if client := limits.clientAddress(c); client.IsValid() {
+					return c.SendString(clientKey(client))
+				}
+				return c.SendString("")
+			})
+
+			address := "127.0.0.1:0"
+			if tt.network == "unix" {
+				address = filepath.Join(t.TempDir(), "srv.sock")
+			}
+			ln, err := net.Listen(tt.network, address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			go app.Listener(ln)
+			defer app.Shutdown()
+
+			client := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, tt.network, ln.Addr().String())
+			}}}
+			request, _ := http.NewRequest(http.MethodGet, "http://blocklistsrv/", nil)
+			if tt.forwardedFor != "" {
+				request.Header.Set(fiber.HeaderXForwardedFor, tt.forwardedFor)
+			}
+			resp, err := client.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			got, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
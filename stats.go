@@ -0,0 +1,86 @@
+package main
+
+import (
+	"AGB-BlocklistSrv/Processing"
+	"AGB-BlocklistSrv/Receivers"
+	"AGB-BlocklistSrv/config"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// missStatisticsResponse is what GET /v1/stats answers with.
+type missStatisticsResponse struct {
+	From    time.Time
+	To      time.Time
+	By      string
+	Results []Receivers.StatisticsEntry
+}
+
+// missStatistics answers which objects or worlds were missed most. It takes window (like 12h or 7d, defaults to
+// 24h), blocklist, world (hashed ID or friendly name), by (object or world) and top (defaults to 10, 0 for all).
+func missStatistics(c *fiber.Ctx) error {
+	if !slices.Contains(config.Current().ReceiverNames(), "stats") {
+		return Processing.NewProblem(fiber.StatusNotFound, "the stats receiver isn't configured")
+	}
+
+	var invalid []Processing.InvalidParam
+	window, err := parseWindow(c.Query("window", "24h"))
+	if err != nil {
+		invalid = append(invalid, Processing.InvalidParam{Name: "window", Reason: err.Error()})
+	} else if retention := Receivers.MissStatistics.Retention(); window > retention {
+		invalid = append(invalid, Processing.InvalidParam{Name: "window", Reason: "longer than the retention of " + retention.String()})
+	}
+	by := c.Query("by", "object")
+	if by != "object" && by != "world" {
+		invalid = append(invalid, Processing.InvalidParam{Name: "by", Reason: "neither object nor world"})
+	}
+	top, err := strconv.Atoi(c.Query("top", "10"))
+	if err != nil || top < 0 {
+		invalid = append(invalid, Processing.InvalidParam{Name: "top", Reason: "not a number of at least 0"})
+	}
+	if len(invalid) > 0 {
+		problem := Processing.NewProblem(fiber.StatusBadRequest, "invalid statistics query")
+		problem.InvalidParams = invalid
+		return problem
+	}
+
+	now := time.Now().UTC()
+	query := Receivers.StatisticsQuery{
+		Since:     now.Add(-window),
+		Blocklist: c.Query("blocklist"),
+		World:     c.Query("world"),
+		By:        by,
+		Top:       top,
+	}
+	return c.JSON(missStatisticsResponse{
+		From:    query.Since.Truncate(time.Hour),
+		To:      now,
+		By:      by,
+		Results: Receivers.MissStatistics.Query(query),
+	})
+}
+
+// parseWindow parses a duration, additionally accepting whole days like 7d.
+func parseWindow(value string) (time.Duration, error) {
+	var window time.Duration
+	if days, isDays := strings.CutSuffix(value, "d"); isDays {
+		count, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, errors.New("not a number of days")
+		}
+		window = time.Duration(count) * 24 * time.Hour
+	} else {
+		var err error
+		if window, err = time.ParseDuration(value); err != nil {
+			return 0, errors.New("not a duration")
+		}
+	}
+	if window <= 0 {
+		return 0, errors.New("not positive")
+	}
+	return window, nil
+}